@@ -2,22 +2,111 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"helmish/pkg/helmishlib"
 )
 
-// parseConfig parses command-line flags and environment variables to build Options
-func parseConfig() helmishlib.Options {
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// debug enables debug output on stderr, set by --debug or HELMISH_DEBUG
+var debug bool
+
+// showNotes prints the rendered NOTES.txt of the chart, set by --notes or
+// HELMISH_NOTES
+var showNotes bool
+
+// debugf prints a debug message on stderr if debug output is enabled
+func debugf(format string, args ...interface{}) {
+	if debug {
+		fmt.Fprintf(os.Stderr, "[debug] "+format+"\n", args...)
+	}
+}
+
+// parseConfig parses command-line flags and environment variables to find the
+// chart path and build Options
+func parseConfig() (string, helmishlib.Options, error) {
 	// Define flags
 	chartPathFlag := flag.String("chart-path", "", "Path to the Helm chart")
 	profileNameFlag := flag.String("profile", "", "Profile name")
+	profileDirFlag := flag.String("profile-dir", "", "Directory searched for profiles before the chart's profiles/")
+	releaseNameFlag := flag.String("release-name", "", "Release name (.Release.Name)")
+	namespaceFlag := flag.String("namespace", "", "Release namespace (.Release.Namespace)")
+	revisionFlag := flag.Int("revision", 0, "Release revision (.Release.Revision)")
+	upgradeFlag := flag.Bool("upgrade", false, "Render as an upgrade (.Release.IsUpgrade)")
+	skipCRDsFlag := flag.Bool("skip-crds", false, "Don't print the files of the crds/ directories")
+	notesFlag := flag.Bool("notes", false, "Print the rendered NOTES.txt of the chart")
+	debugFlag := flag.Bool("debug", false, "Print debug output, e.g. the files .helmignore excluded, on stderr")
+	var valuesFlag stringList
+	flag.Var(&valuesFlag, "f", "Values file layered on the chart values (can be repeated)")
+	flag.Var(&valuesFlag, "values", "Same as -f")
+	var setFlag, setStringFlag, setJSONFlag, setFileFlag stringList
+	flag.Var(&setFlag, "set", "Set values, e.g. a.b[0].c=x,d=y (can be repeated)")
+	flag.Var(&setStringFlag, "set-string", "Set string values (can be repeated)")
+	flag.Var(&setJSONFlag, "set-json", "Set JSON values, e.g. a={\"b\":1} (can be repeated)")
+	flag.Var(&setFileFlag, "set-file", "Set values from files, e.g. cert=tls.crt (can be repeated)")
 
 	flag.Parse()
 
 	// Get from env vars first
 	chartPath := os.Getenv("HELMISH_CHART_PATH")
 	profileName := os.Getenv("HELMISH_PROFILE")
+	profileDir := os.Getenv("HELMISH_PROFILE_DIR")
+	release := helmishlib.Release{
+		Name:      os.Getenv("HELMISH_RELEASE_NAME"),
+		Namespace: os.Getenv("HELMISH_NAMESPACE"),
+	}
+	var valuesFiles []string
+	if v := os.Getenv("HELMISH_VALUES"); v != "" {
+		valuesFiles = strings.Split(v, ",")
+	}
+	if v := os.Getenv("HELMISH_REVISION"); v != "" {
+		revision, err := strconv.Atoi(v)
+		if err != nil {
+			return "", helmishlib.Options{}, fmt.Errorf("invalid HELMISH_REVISION %q: %v", v, err)
+		}
+		release.Revision = revision
+	}
+	if v := os.Getenv("HELMISH_UPGRADE"); v != "" {
+		upgrade, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", helmishlib.Options{}, fmt.Errorf("invalid HELMISH_UPGRADE %q: %v", v, err)
+		}
+		release.IsUpgrade = &upgrade
+	}
+	var skipCRDs bool
+	if v := os.Getenv("HELMISH_SKIP_CRDS"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", helmishlib.Options{}, fmt.Errorf("invalid HELMISH_SKIP_CRDS %q: %v", v, err)
+		}
+		skipCRDs = skip
+	}
+	if v := os.Getenv("HELMISH_NOTES"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", helmishlib.Options{}, fmt.Errorf("invalid HELMISH_NOTES %q: %v", v, err)
+		}
+		showNotes = enabled
+	}
+	if v := os.Getenv("HELMISH_DEBUG"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", helmishlib.Options{}, fmt.Errorf("invalid HELMISH_DEBUG %q: %v", v, err)
+		}
+		debug = enabled
+	}
 
 	// Flags take precedence over env vars
 	if *chartPathFlag != "" {
@@ -26,6 +115,37 @@ func parseConfig() helmishlib.Options {
 	if *profileNameFlag != "" {
 		profileName = *profileNameFlag
 	}
+	if *profileDirFlag != "" {
+		profileDir = *profileDirFlag
+	}
+	if *releaseNameFlag != "" {
+		release.Name = *releaseNameFlag
+	}
+	if *namespaceFlag != "" {
+		release.Namespace = *namespaceFlag
+	}
+	if *revisionFlag != 0 {
+		release.Revision = *revisionFlag
+	}
+	// --upgrade=false overrides a profile that renders as an upgrade, so
+	// it is applied whenever it is given
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "upgrade" {
+			release.IsUpgrade = upgradeFlag
+		}
+	})
+	if *skipCRDsFlag {
+		skipCRDs = true
+	}
+	if *notesFlag {
+		showNotes = true
+	}
+	if *debugFlag {
+		debug = true
+	}
+	if len(valuesFlag) > 0 {
+		valuesFiles = valuesFlag
+	}
 
 	// Positional arg takes precedence
 	if flag.NArg() > 0 {
@@ -40,12 +160,17 @@ func parseConfig() helmishlib.Options {
 		profileName = "default"
 	}
 
-	return helmishlib.Options{
-		Chart: helmishlib.Chart{
-			Path: chartPath,
-		},
+	return chartPath, helmishlib.Options{
 		Profile: helmishlib.Profile{
-			Name: profileName,
+			Name:    profileName,
+			Dir:     profileDir,
+			Release: release,
 		},
-	}
+		ValuesFiles: valuesFiles,
+		Set:         setFlag,
+		SetString:   setStringFlag,
+		SetJSON:     setJSONFlag,
+		SetFile:     setFileFlag,
+		SkipCRDs:    skipCRDs,
+	}, nil
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"helmish/pkg/helmishlib"
@@ -11,11 +12,15 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: helmish <chart-path>")
+		fmt.Println("Usage: helmish [flags] <chart-path | chart.tgz>")
 		os.Exit(1)
 	}
 
-	chartPath := os.Args[1]
+	chartPath, opts, err := parseConfig()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Check if the path is absolute, if not make it relative to current directory
 	if !filepath.IsAbs(chartPath) {
@@ -33,29 +38,62 @@ func main() {
 		fmt.Printf("Error loading chart: %v\n", err)
 		os.Exit(1)
 	}
+	for _, p := range h.Ignored() {
+		debugf("ignored by .helmignore: %s", p)
+	}
 
 	// Render the chart
-	tokens, err := h.Render(helmishlib.Profile{Name: "default"})
+	result, err := h.RenderResult(opts)
 	if err != nil {
 		fmt.Printf("Error rendering chart: %v\n", err)
 		os.Exit(1)
 	}
+	tokens := result.Manifests
+
+	// CRDs are displayed first, as they must be applied before the
+	// manifests that use them
+	var crdNames []string
+	for filename := range result.CRDs {
+		crdNames = append(crdNames, filename)
+	}
+	sort.Strings(crdNames)
+	var filenames []string
+	for filename := range tokens {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
 
 	// Display tokenized output - group tokens by line
 	fmt.Println("=== TOKENIZED OUTPUT ===")
-	for filename, fileTokens := range tokens {
+	for _, filename := range crdNames {
 		fmt.Printf("\n--- %s ---\n", filename)
-		for _, docTokens := range fileTokens {
+		for _, docTokens := range result.CRDs[filename] {
+			printTokensByLine(docTokens)
+		}
+	}
+	for _, filename := range filenames {
+		fmt.Printf("\n--- %s ---\n", filename)
+		for _, docTokens := range tokens[filename] {
 			printTokensByLine(docTokens)
 		}
 	}
 
 	// Display string rendered output
 	fmt.Println("\n=== RENDERED OUTPUT ===")
+	renderedCRDs := helmishlib.RenderAllFilesToString(result.CRDs)
+	for _, filename := range crdNames {
+		fmt.Printf("\n--- %s ---\n", filename)
+		fmt.Println(strings.TrimSuffix(renderedCRDs[filename], "\n"))
+	}
 	renderedFiles := helmishlib.RenderAllFilesToString(tokens)
-	for filename, content := range renderedFiles {
+	for _, filename := range filenames {
 		fmt.Printf("\n--- %s ---\n", filename)
-		fmt.Println(strings.TrimSuffix(content, "\n"))
+		fmt.Println(strings.TrimSuffix(renderedFiles[filename], "\n"))
+	}
+
+	if showNotes && result.Notes != "" {
+		fmt.Println("\n=== NOTES ===")
+		fmt.Println(strings.TrimSuffix(result.Notes, "\n"))
 	}
 }
 
@@ -2,132 +2,14 @@ package ast
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"helmish/internal/renderer/types"
 )
 
-// CondTokenType represents the type of condition token
-type CondTokenType int
-
-const (
-	CondExpr CondTokenType = iota
-	CondAnd
-	CondOr
-	CondNot
-)
-
-// CondToken represents a token in a condition expression
-type CondToken struct {
-	Type  CondTokenType
-	Value string
-}
-
-// CondNode represents a condition node that evaluates to a boolean
-type CondNode struct {
-	Tokens []CondToken
-}
-
-// Eval evaluates the condition and returns a boolean result
-func (n *CondNode) Eval(ctx *types.EvalContext) (bool, error) {
-	if len(n.Tokens) == 0 {
-		return false, nil
-	}
-	if len(n.Tokens) == 1 && n.Tokens[0].Type == CondExpr {
-		result, err := ctx.EvaluateSimple("{{" + n.Tokens[0].Value + "}}")
-		if err != nil {
-			return false, err
-		}
-		return types.IsTruthy(result), nil
-	}
-	// Check if prefix operator
-	if n.Tokens[0].Type == CondAnd || n.Tokens[0].Type == CondOr || n.Tokens[0].Type == CondNot {
-		op := n.Tokens[0]
-		exprs := n.Tokens[1:]
-		switch op.Type {
-		case CondAnd:
-			result := true
-			for _, expr := range exprs {
-				if expr.Type != CondExpr {
-					return false, fmt.Errorf("invalid condition: expected expression after and")
-				}
-				val, err := ctx.EvaluateSimple("{{" + expr.Value + "}}")
-				if err != nil {
-					return false, err
-				}
-				if !types.IsTruthy(val) {
-					result = false
-				}
-			}
-			return result, nil
-		case CondOr:
-			result := false
-			for _, expr := range exprs {
-				if expr.Type != CondExpr {
-					return false, fmt.Errorf("invalid condition: expected expression after or")
-				}
-				val, err := ctx.EvaluateSimple("{{" + expr.Value + "}}")
-				if err != nil {
-					return false, err
-				}
-				if types.IsTruthy(val) {
-					result = true
-				}
-			}
-			return result, nil
-		case CondNot:
-			if len(exprs) != 1 || exprs[0].Type != CondExpr {
-				return false, fmt.Errorf("invalid condition: not expects one expression")
-			}
-			val, err := ctx.EvaluateSimple("{{" + exprs[0].Value + "}}")
-			if err != nil {
-				return false, err
-			}
-			return !types.IsTruthy(val), nil
-		}
-	} else {
-		// Assume infix: expr op expr
-		if len(n.Tokens) == 3 && n.Tokens[0].Type == CondExpr && n.Tokens[2].Type == CondExpr {
-			left, err := ctx.EvaluateSimple("{{" + n.Tokens[0].Value + "}}")
-			if err != nil {
-				return false, err
-			}
-			right, err := ctx.EvaluateSimple("{{" + n.Tokens[2].Value + "}}")
-			if err != nil {
-				return false, err
-			}
-			switch n.Tokens[1].Type {
-			case CondAnd:
-				return types.IsTruthy(left) && types.IsTruthy(right), nil
-			case CondOr:
-				return types.IsTruthy(left) || types.IsTruthy(right), nil
-			default:
-				return false, fmt.Errorf("unsupported infix operator")
-			}
-		}
-	}
-	return false, fmt.Errorf("invalid condition structure")
-}
-
-// parseCondition parses a condition string into condition tokens
-func parseCondition(cond string) []CondToken {
-	parts := strings.Fields(cond)
-	var tokens []CondToken
-	for _, part := range parts {
-		switch part {
-		case "and":
-			tokens = append(tokens, CondToken{Type: CondAnd})
-		case "or":
-			tokens = append(tokens, CondToken{Type: CondOr})
-		case "not":
-			tokens = append(tokens, CondToken{Type: CondNot})
-		default:
-			tokens = append(tokens, CondToken{Type: CondExpr, Value: part})
-		}
-	}
-	return tokens
-}
-
 // Node represents a node in the AST
 type Node interface {
 	Eval(ctx *types.EvalContext, out *[]types.Token) error
@@ -147,13 +29,23 @@ func (n *TextNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 // ActionNode represents an action node with a token
 type ActionNode struct {
 	Token types.Token
+	Pipe  *Pipeline // the parsed pipeline of the action
 }
 
 // Eval evaluates the action node
 func (n *ActionNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
-	resultVal, err := ctx.Evaluate(n.Token.Value)
+	resultVal, err := n.Pipe.Eval(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("line %d: %v", n.Token.Line, err)
+	}
+	if len(n.Pipe.Decl) > 0 {
+		// Declarations and assignments print nothing, but the token is
+		// kept so its whitespace control still applies
+		resultVal = ""
+	}
+	if resultVal == nil {
+		// Helm renders missing values as empty strings
+		resultVal = ""
 	}
 	// Create a new token with the evaluated value instead of modifying in place
 	// This is important for range loops where the same action is evaluated multiple times
@@ -169,20 +61,37 @@ func (n *ActionNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 	return nil
 }
 
+// CommentNode represents a {{/* comment */}} action, which prints nothing
+type CommentNode struct {
+	Token types.Token
+}
+
+// Eval evaluates the comment node. An empty token is emitted so the
+// comment's whitespace control still applies.
+func (n *CommentNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
+	tok := n.Token
+	tok.Value = ""
+	*out = append(*out, tok)
+	return nil
+}
+
 // IfNode represents an if node with condition, then, and else branches
 type IfNode struct {
-	Cond *CondNode
-	Then []Node
-	Else []Node
+	Condition string // The condition expression
+	Pipe      *Pipeline
+	Then      []Node
+	Else      []Node
 }
 
-// Eval evaluates the if node
+// Eval evaluates the if node. Variables declared in the condition or the
+// branches are scoped to the if.
 func (n *IfNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
-	condBool, err := n.Cond.Eval(ctx)
+	ctx = ctx.WithScope()
+	result, err := n.Pipe.Eval(ctx)
 	if err != nil {
 		return err
 	}
-	if condBool {
+	if types.IsTruthy(result) {
 		for _, node := range n.Then {
 			err := node.Eval(ctx, out)
 			if err != nil {
@@ -200,77 +109,124 @@ func (n *IfNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 	return nil
 }
 
-// RangeNode represents a range node that iterates over a list or map
+// RangeNode represents a range node that iterates over a list, map or integer
 type RangeNode struct {
-	Variable   string // The variable name for the current item (e.g., "." or "$item")
+	Key        string // The variable for the index or map key (e.g., "$i"), empty if not declared
+	Variable   string // The variable for the current item (e.g., "$item"), empty if not declared
 	Collection string // The expression to iterate over
+	Pipe       *Pipeline
 	Body       []Node
+	Else       []Node // Evaluated when the collection is empty or nil
 }
 
 // Eval evaluates the range node
 func (n *RangeNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 	// Get the collection value (actual typed value, not string representation)
-	result, err := ctx.GetValue(n.Collection)
+	result, err := n.Pipe.Eval(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Handle different collection types
-	switch collection := result.(type) {
-	case []interface{}:
-		for _, item := range collection {
-			// Create a new context with the current item as the Values
-			// This makes . refer to the current item in the range
-			itemCtx := &types.EvalContext{
-				Values: item,
-				Chart:  ctx.Chart,
-				Root:   ctx.Root,
-			}
-			// Evaluate each node in the body
-			for _, node := range n.Body {
-				err := node.Eval(itemCtx, out)
-				if err != nil {
+	iterations := 0
+	if result != nil {
+		rv := reflect.ValueOf(result)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				if err := n.evalIteration(ctx, i, rv.Index(i).Interface(), out); err != nil {
 					return err
 				}
 			}
-		}
-	case map[string]interface{}:
-		for _, value := range collection {
-			// Create a new context with the current value as the Values
-			itemCtx := &types.EvalContext{
-				Values: value,
-				Chart:  ctx.Chart,
-				Root:   ctx.Root,
+			iterations = rv.Len()
+		case reflect.Map:
+			// Maps are visited in sorted key order, like Helm, so that
+			// renders are reproducible
+			for _, key := range sortedMapKeys(rv) {
+				if err := n.evalIteration(ctx, key.Interface(), rv.MapIndex(key).Interface(), out); err != nil {
+					return err
+				}
 			}
-			// Evaluate each node in the body
-			for _, node := range n.Body {
-				err := node.Eval(itemCtx, out)
-				if err != nil {
+			iterations = rv.Len()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// Ranging over an integer n iterates over 0..n-1
+			for i := 0; i < int(rv.Int()); i++ {
+				if err := n.evalIteration(ctx, i, i, out); err != nil {
 					return err
 				}
+				iterations++
 			}
+		default:
+			return fmt.Errorf("range can't iterate over %v", result)
 		}
-	default:
-		// If it's not a collection we can iterate over, just evaluate the body once
-		// or we could return an error - for now, let's skip
 	}
 
+	if iterations == 0 {
+		for _, node := range n.Else {
+			if err := node.Eval(ctx, out); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// evalIteration evaluates the body once with . bound to the current item and
+// the range variables, if declared, bound to its index or key and value.
+// Variables declared in the body are scoped to the iteration.
+func (n *RangeNode) evalIteration(ctx *types.EvalContext, key, item interface{}, out *[]types.Token) error {
+	itemCtx := ctx.WithDot(item).WithScope()
+	if n.Key != "" {
+		itemCtx.Vars.Declare(n.Key, key)
+	}
+	if n.Variable != "" {
+		itemCtx.Vars.Declare(n.Variable, item)
+	}
+	for _, node := range n.Body {
+		if err := node.Eval(itemCtx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedMapKeys returns the keys of a map ordered the way text/template
+// ranges over them: numbers numerically, strings lexically, and keys of
+// differing types grouped by type
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i].Interface(), keys[j].Interface()
+		if c, err := compareValues(a, b); err == nil {
+			return c < 0
+		}
+		ta, tb := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)
+		if ta != tb {
+			return ta < tb
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return keys
+}
+
 // WithNode represents a with node that re-scopes the context
 type WithNode struct {
 	Expression string // The expression to evaluate and re-scope to
+	Pipe       *Pipeline
 	Body       []Node
 	Else       []Node
 }
 
-// Eval evaluates the with node
+// Eval evaluates the with node. Variables declared in the header or the
+// body are scoped to the with.
 func (n *WithNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
+	ctx = ctx.WithScope()
 	// Get the value for the expression
-	result, err := ctx.GetValue(n.Expression)
-	if err != nil || !types.IsTruthy(result) {
-		// Value doesn't exist or is falsy, execute else branch
+	result, err := n.Pipe.Eval(ctx)
+	if err != nil {
+		return err
+	}
+	if !types.IsTruthy(result) {
+		// Value is falsy, execute else branch
 		for _, node := range n.Else {
 			if err := node.Eval(ctx, out); err != nil {
 				return err
@@ -280,11 +236,7 @@ func (n *WithNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 	}
 
 	// Create a new context with the value as the new scope
-	withCtx := &types.EvalContext{
-		Values: result,
-		Chart:  ctx.Chart,
-		Root:   ctx.Root,
-	}
+	withCtx := ctx.WithDot(result)
 	for _, node := range n.Body {
 		if err := node.Eval(withCtx, out); err != nil {
 			return err
@@ -293,87 +245,354 @@ func (n *WithNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
 	return nil
 }
 
+// DefineNode represents a {{ define "name" }} block. It renders nothing in
+// place; its body is executed through {{ template }} or include.
+type DefineNode struct {
+	Name string
+	Body []Node
+}
+
+// Eval evaluates the define node, which produces no output
+func (n *DefineNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
+	return nil
+}
+
+// TemplateNode represents a {{ template "name" pipeline }} action
+type TemplateNode struct {
+	Token    types.Token
+	Name     string
+	Pipeline string    // The data passed to the template, empty for none
+	Pipe     *Pipeline // The parsed data pipeline, nil for none
+}
+
+// Eval executes the named template and emits its output as a single token
+func (n *TemplateNode) Eval(ctx *types.EvalContext, out *[]types.Token) error {
+	var data interface{}
+	if n.Pipe != nil {
+		var err error
+		data, err = n.Pipe.Eval(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	rendered, err := ExecuteTemplate(ctx, n.Name, data)
+	if err != nil {
+		return err
+	}
+	*out = append(*out, types.Token{
+		Type:      types.TokenAction,
+		Value:     rendered,
+		Line:      n.Token.Line,
+		Indent:    n.Token.Indent,
+		TrimLeft:  n.Token.TrimLeft,
+		TrimRight: n.Token.TrimRight,
+	})
+	return nil
+}
+
+// ExecuteTemplate runs the named template with data as both . and $ and
+// returns its output
+func ExecuteTemplate(ctx *types.EvalContext, name string, data interface{}) (string, error) {
+	tmpl, ok := ctx.Templates[name]
+	if !ok {
+		return "", fmt.Errorf("no template %q associated with template", name)
+	}
+	leave, err := ctx.EnterTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	defer leave()
+	tokens, err := tmpl.Execute(ctx.ForTemplate(data))
+	if err != nil {
+		if ctx.Calls.Err != nil {
+			return "", ctx.Calls.Err
+		}
+		return "", fmt.Errorf("error calling %s: %v", name, err)
+	}
+	var sb strings.Builder
+	for _, tok := range tokens {
+		sb.WriteString(tok.Value)
+	}
+	return sb.String(), nil
+}
+
+// parseTemplateName splits the quoted template name off the start of a
+// define or template header and returns it with the rest of the header
+func parseTemplateName(header string) (string, string) {
+	header = strings.TrimSpace(header)
+	if header == "" || (header[0] != '"' && header[0] != '`') {
+		return header, ""
+	}
+	end, err := skipString(header, 0)
+	if err != nil {
+		return header, ""
+	}
+	name, err := strconv.Unquote(header[:end+1])
+	if err != nil {
+		return header, ""
+	}
+	return name, strings.TrimSpace(header[end+1:])
+}
+
 // ParseAST parses a list of tokens into an AST
 func ParseAST(tokens []types.Token) ([]Node, error) {
-	nodes, _ := parseBlock(tokens, 0)
+	return parseBlock(trimControlWhitespace(tokens), 0)
+}
+
+// trimControlWhitespace applies the {{- and -}} markers of control
+// structures to the neighbouring source text. Control tokens produce no
+// output of their own, so unlike actions they cannot be trimmed after
+// evaluation. The input tokens are not modified.
+func trimControlWhitespace(tokens []types.Token) []types.Token {
+	trimmed := make([]types.Token, len(tokens))
+	copy(trimmed, tokens)
+	for i, tok := range trimmed {
+		if tok.Type == types.TokenText || tok.Type == types.TokenAction || tok.Type == types.TokenTemplate {
+			continue
+		}
+		if tok.TrimLeft {
+			for j := i - 1; j >= 0 && trimmed[j].Type == types.TokenText; j-- {
+				trimmed[j].Value = strings.TrimRight(trimmed[j].Value, " \t\n\r")
+				if trimmed[j].Value != "" {
+					break
+				}
+			}
+		}
+		if tok.TrimRight {
+			for j := i + 1; j < len(trimmed) && trimmed[j].Type == types.TokenText; j++ {
+				trimmed[j].Value = strings.TrimLeft(trimmed[j].Value, " \t\n\r")
+				if trimmed[j].Value != "" {
+					break
+				}
+			}
+		}
+	}
+	return trimmed
+}
+
+// parseBlock parses the top level of a template. Every block opened inside it
+// must be closed, and an else or end without a matching block is an error.
+func parseBlock(tokens []types.Token, start int) ([]Node, error) {
+	nodes, i, err := parseNodes(tokens, start)
+	if err != nil {
+		return nil, err
+	}
+	if i < len(tokens) {
+		return nil, fmt.Errorf("line %d: unexpected %s", tokens[i].Line, actionLabel(tokens[i]))
+	}
 	return nodes, nil
 }
 
-// parseBlock parses a block of tokens until a terminator
-func parseBlock(tokens []types.Token, start int, terminators ...types.TokenType) ([]Node, int) {
+// parseNodes parses tokens until an else or end token, which is left for the
+// caller, or until the end of input. It returns the nodes and the index of
+// the token it stopped at.
+func parseNodes(tokens []types.Token, start int) ([]Node, int, error) {
 	var nodes []Node
 	i := start
 	for i < len(tokens) {
-		for _, term := range terminators {
-			if tokens[i].Type == term {
-				return nodes, i
-			}
-		}
-		switch tokens[i].Type {
+		tok := tokens[i]
+		inner := actionInner(tok.Value)
+		switch tok.Type {
+		case types.TokenElse, types.TokenEnd:
+			return nodes, i, nil
 		case types.TokenText:
-			nodes = append(nodes, &TextNode{Token: tokens[i]})
+			nodes = append(nodes, &TextNode{Token: tok})
 		case types.TokenAction:
-			nodes = append(nodes, &ActionNode{Token: tokens[i]})
-		case types.TokenIf:
-			// Recursive for nested if
-			inner := strings.TrimSpace(strings.TrimSuffix(tokens[i].Value, "}}")[2:])
-			condStr := strings.TrimSpace(inner[2:]) // remove "if"
-			condTokens := parseCondition(condStr)
-			condNode := &CondNode{Tokens: condTokens}
-			ifNode := &IfNode{Cond: condNode}
-			i++
-			thenNodes, newI := parseBlock(tokens, i, types.TokenElse, types.TokenEnd)
-			ifNode.Then = thenNodes
-			i = newI
-			if i < len(tokens) && tokens[i].Type == types.TokenElse {
-				i++
-				elseNodes, newI := parseBlock(tokens, i, types.TokenEnd)
-				ifNode.Else = elseNodes
-				i = newI
+			if strings.HasPrefix(inner, "/*") {
+				if !strings.HasSuffix(inner, "*/") {
+					return nil, i, fmt.Errorf("line %d: unclosed comment", tok.Line)
+				}
+				nodes = append(nodes, &CommentNode{Token: tok})
+				break
 			}
-			if i < len(tokens) && tokens[i].Type == types.TokenEnd {
-				i++
+			pipe, err := ParsePipeline(inner)
+			if err != nil {
+				return nil, i, fmt.Errorf("line %d: %v", tok.Line, err)
+			}
+			nodes = append(nodes, &ActionNode{Token: tok, Pipe: pipe})
+		case types.TokenIf:
+			ifNode, newI, err := parseIf(tokens, i, strings.TrimSpace(inner[len("if"):]))
+			if err != nil {
+				return nil, i, err
 			}
 			nodes = append(nodes, ifNode)
+			i = newI
 			continue
 		case types.TokenRange:
-			// Parse range expression
-			inner := strings.TrimSpace(strings.TrimSuffix(tokens[i].Value, "}}")[2:])
-			rangeExpr := strings.TrimSpace(inner[5:]) // remove "range"
+			rangeExpr := strings.TrimSpace(inner[len("range"):])
 			rangeNode := &RangeNode{Collection: rangeExpr}
-			i++
-			bodyNodes, newI := parseBlock(tokens, i, types.TokenEnd)
+			// range $item := ... or range $i, $item := ...
+			if vars, _, rest := splitDeclaration(rangeExpr); len(vars) > 0 {
+				if len(vars) > 2 {
+					return nil, i, fmt.Errorf("line %d: too many declarations in range", tok.Line)
+				}
+				rangeNode.Collection = strings.TrimSpace(rest)
+				rangeNode.Variable = vars[len(vars)-1]
+				if len(vars) == 2 {
+					rangeNode.Key = vars[0]
+				}
+			}
+			pipe, err := parseControlPipeline(tok, "range", rangeNode.Collection)
+			if err != nil {
+				return nil, i, err
+			}
+			rangeNode.Pipe = pipe
+			bodyNodes, newI, err := parseNodes(tokens, i+1)
+			if err != nil {
+				return nil, i, err
+			}
 			rangeNode.Body = bodyNodes
-			i = newI
-			if i < len(tokens) && tokens[i].Type == types.TokenEnd {
-				i++
+			rangeNode.Else, i, err = parseElse(tokens, newI, tok, "range")
+			if err != nil {
+				return nil, i, err
 			}
 			nodes = append(nodes, rangeNode)
 			continue
 		case types.TokenWith:
-			// Parse with expression
-			inner := strings.TrimSpace(strings.TrimSuffix(tokens[i].Value, "}}")[2:])
-			withExpr := strings.TrimSpace(inner[4:]) // remove "with"
-			withNode := &WithNode{Expression: withExpr}
-			i++
-			bodyNodes, newI := parseBlock(tokens, i, types.TokenElse, types.TokenEnd)
-			withNode.Body = bodyNodes
+			withNode, newI, err := parseWith(tokens, i, strings.TrimSpace(inner[len("with"):]))
+			if err != nil {
+				return nil, i, err
+			}
+			nodes = append(nodes, withNode)
 			i = newI
-			if i < len(tokens) && tokens[i].Type == types.TokenElse {
-				i++
-				elseNodes, newI := parseBlock(tokens, i, types.TokenEnd)
-				withNode.Else = elseNodes
-				i = newI
+			continue
+		case types.TokenDefine:
+			name, _ := parseTemplateName(inner[len("define"):])
+			defineNode := &DefineNode{Name: name}
+			bodyNodes, newI, err := parseNodes(tokens, i+1)
+			if err != nil {
+				return nil, i, err
 			}
-			if i < len(tokens) && tokens[i].Type == types.TokenEnd {
-				i++
+			if newI >= len(tokens) || tokens[newI].Type != types.TokenEnd {
+				return nil, i, missingEnd(tokens, newI, tok, "define")
 			}
-			nodes = append(nodes, withNode)
+			defineNode.Body = bodyNodes
+			i = newI + 1
+			nodes = append(nodes, defineNode)
 			continue
-		default:
-			// Skip other tokens for now
+		case types.TokenTemplate:
+			name, pipeline := parseTemplateName(inner[len("template"):])
+			templateNode := &TemplateNode{Token: tok, Name: name, Pipeline: pipeline}
+			if pipeline != "" {
+				pipe, err := ParsePipeline(pipeline)
+				if err != nil {
+					return nil, i, fmt.Errorf("line %d: %v", tok.Line, err)
+				}
+				templateNode.Pipe = pipe
+			}
+			nodes = append(nodes, templateNode)
 		}
 		i++
 	}
-	return nodes, i
-}
\ No newline at end of file
+	return nodes, i, nil
+}
+
+// parseControlPipeline parses the pipeline of an if, range or with, which
+// must not be empty
+func parseControlPipeline(tok types.Token, keyword, expr string) (*Pipeline, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("line %d: missing value for %s", tok.Line, keyword)
+	}
+	pipe, err := ParsePipeline(expr)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", tok.Line, err)
+	}
+	return pipe, nil
+}
+
+// actionLabel names a control token in error messages, e.g. {{else}}
+func actionLabel(tok types.Token) string {
+	return "{{" + strings.Fields(actionInner(tok.Value) + " ")[0] + "}}"
+}
+
+// missingEnd builds the error for a block opened by open that is not closed
+// by the time the parser stops at tokens[i]
+func missingEnd(tokens []types.Token, i int, open types.Token, keyword string) error {
+	if i < len(tokens) {
+		return fmt.Errorf("line %d: unexpected %s in %s", tokens[i].Line, actionLabel(tokens[i]), keyword)
+	}
+	return fmt.Errorf("line %d: unexpected EOF: %s has no matching {{end}}", open.Line, keyword)
+}
+
+// parseIf parses an if whose opening token is tokens[start] and whose
+// condition has already been read. It returns the node and the index after
+// the matching end.
+func parseIf(tokens []types.Token, start int, cond string) (*IfNode, int, error) {
+	open := tokens[start]
+	pipe, err := parseControlPipeline(open, "if", cond)
+	if err != nil {
+		return nil, start, err
+	}
+	ifNode := &IfNode{Condition: cond, Pipe: pipe}
+	thenNodes, i, err := parseNodes(tokens, start+1)
+	if err != nil {
+		return nil, start, err
+	}
+	ifNode.Then = thenNodes
+	ifNode.Else, i, err = parseElse(tokens, i, open, "if")
+	if err != nil {
+		return nil, start, err
+	}
+	return ifNode, i, nil
+}
+
+// parseWith parses a with whose opening token is tokens[start] and whose
+// expression has already been read. It returns the node and the index after
+// the matching end.
+func parseWith(tokens []types.Token, start int, expr string) (*WithNode, int, error) {
+	open := tokens[start]
+	pipe, err := parseControlPipeline(open, "with", expr)
+	if err != nil {
+		return nil, start, err
+	}
+	withNode := &WithNode{Expression: expr, Pipe: pipe}
+	bodyNodes, i, err := parseNodes(tokens, start+1)
+	if err != nil {
+		return nil, start, err
+	}
+	withNode.Body = bodyNodes
+	withNode.Else, i, err = parseElse(tokens, i, open, "with")
+	if err != nil {
+		return nil, start, err
+	}
+	return withNode, i, nil
+}
+
+// parseElse parses an optional else branch at tokens[i] up to and including
+// the closing end of the block opened by open. {{ else if }} and
+// {{ else with }} become a nested if or with node that shares the end of the
+// enclosing chain.
+func parseElse(tokens []types.Token, i int, open types.Token, keyword string) ([]Node, int, error) {
+	var elseNodes []Node
+	if i < len(tokens) && tokens[i].Type == types.TokenElse {
+		rest := strings.TrimSpace(strings.TrimSpace(actionInner(tokens[i].Value))[len("else"):])
+		word := rest
+		if j := strings.IndexAny(rest, " \t\r\n"); j >= 0 {
+			word = rest[:j]
+		}
+		expr := strings.TrimSpace(rest[len(word):])
+		switch word {
+		case "if":
+			ifNode, newI, err := parseIf(tokens, i, expr)
+			if err != nil {
+				return nil, i, err
+			}
+			return []Node{ifNode}, newI, nil
+		case "with":
+			withNode, newI, err := parseWith(tokens, i, expr)
+			if err != nil {
+				return nil, i, err
+			}
+			return []Node{withNode}, newI, nil
+		}
+		var err error
+		elseNodes, i, err = parseNodes(tokens, i+1)
+		if err != nil {
+			return nil, i, err
+		}
+	}
+	if i >= len(tokens) || tokens[i].Type != types.TokenEnd {
+		return nil, i, missingEnd(tokens, i, open, keyword)
+	}
+	return elseNodes, i + 1, nil
+}
@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"helmish/internal/renderer/types"
@@ -28,7 +30,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 1 || ifNode.Cond.Tokens[0].Type != CondExpr || ifNode.Cond.Tokens[0].Value != ".Values.enabled" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{".Values.enabled"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -53,7 +55,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondAnd || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"and", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -78,7 +80,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondAnd || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"and", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -103,7 +105,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondAnd || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"and", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -128,7 +130,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondAnd || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"and", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -153,15 +155,9 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 6 || ifNode.Cond.Tokens[0].Type != CondAnd {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"and", ".Values.a", ".Values.b", ".Values.c", ".Values.d", ".Values.e"}) {
 					return false
 				}
-				expected := []string{".Values.a", ".Values.b", ".Values.c", ".Values.d", ".Values.e"}
-				for i, exp := range expected {
-					if ifNode.Cond.Tokens[i+1].Value != exp {
-						return false
-					}
-				}
 				if len(ifNode.Then) != 2 {
 					return false
 				}
@@ -184,7 +180,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondOr || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -209,7 +205,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondOr || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -234,7 +230,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondOr || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -259,7 +255,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondOr || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -284,15 +280,9 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 6 || ifNode.Cond.Tokens[0].Type != CondOr {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b", ".Values.c", ".Values.d", ".Values.e"}) {
 					return false
 				}
-				expected := []string{".Values.a", ".Values.b", ".Values.c", ".Values.d", ".Values.e"}
-				for i, exp := range expected {
-					if ifNode.Cond.Tokens[i+1].Value != exp {
-						return false
-					}
-				}
 				if len(ifNode.Then) != 2 {
 					return false
 				}
@@ -315,7 +305,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 2 || ifNode.Cond.Tokens[0].Type != CondNot || ifNode.Cond.Tokens[1].Value != ".Values.a" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"not", ".Values.a"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -340,7 +330,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 2 || ifNode.Cond.Tokens[0].Type != CondNot || ifNode.Cond.Tokens[1].Value != ".Values.a" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"not", ".Values.a"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -367,7 +357,7 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Type != CondOr || ifNode.Cond.Tokens[1].Value != ".Values.a" || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				if !reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 || len(ifNode.Else) != 1 {
@@ -392,7 +382,9 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Value != ".Values.a" || ifNode.Cond.Tokens[1].Type != CondOr || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				// Not an operator: the condition is a single command, which
+				// fails when it is evaluated, as in Go templates
+				if !reflect.DeepEqual(condArgs(ifNode), []string{".Values.a", "or", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -417,7 +409,9 @@ func TestParseAST(t *testing.T) {
 				if !ok {
 					return false
 				}
-				if len(ifNode.Cond.Tokens) != 3 || ifNode.Cond.Tokens[0].Value != ".Values.a" || ifNode.Cond.Tokens[1].Type != CondAnd || ifNode.Cond.Tokens[2].Value != ".Values.b" {
+				// Not an operator: the condition is a single command, which
+				// fails when it is evaluated, as in Go templates
+				if !reflect.DeepEqual(condArgs(ifNode), []string{".Values.a", "and", ".Values.b"}) {
 					return false
 				}
 				if len(ifNode.Then) != 2 {
@@ -426,6 +420,59 @@ func TestParseAST(t *testing.T) {
 				return true
 			},
 		},
+		{
+			name: "and with parenthesized operands",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if and (.Values.a) (not .Values.b)}}", Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "  key1: val1\n", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				ifNode, ok := nodes[0].(*IfNode)
+				if !ok {
+					return false
+				}
+				return reflect.DeepEqual(condArgs(ifNode), []string{"and", "(.Values.a)", "(not .Values.b)"})
+			},
+		},
+		{
+			name: "comparison with string literal containing spaces",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: `{{if eq .Values.env "prod env"}}`, Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "  key1: val1\n", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				ifNode, ok := nodes[0].(*IfNode)
+				if !ok {
+					return false
+				}
+				return reflect.DeepEqual(condArgs(ifNode), []string{"eq", ".Values.env", `"prod env"`})
+			},
+		},
+		{
+			name: "or with string literal operand",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: `{{if or .Values.a "a b"}}`, Line: 1, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 2, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				ifNode, ok := nodes[0].(*IfNode)
+				if !ok {
+					return false
+				}
+				return reflect.DeepEqual(condArgs(ifNode), []string{"or", ".Values.a", `"a b"`})
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -526,6 +573,63 @@ func TestParseAST_Range(t *testing.T) {
 				return true
 			},
 		},
+		{
+			name: "range with value variable",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{range $item := .Values.items}}", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{$item}}", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				rangeNode, ok := nodes[0].(*RangeNode)
+				if !ok {
+					return false
+				}
+				return rangeNode.Collection == ".Values.items" && rangeNode.Variable == "$item" && rangeNode.Key == ""
+			},
+		},
+		{
+			name: "range with key and value variables",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{- range $k, $v := .Values.env }}", Line: 1, Indent: 0, TrimLeft: true},
+				{Type: types.TokenAction, Value: "{{$k}}={{$v}}", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				rangeNode, ok := nodes[0].(*RangeNode)
+				if !ok {
+					return false
+				}
+				return rangeNode.Collection == ".Values.env" && rangeNode.Key == "$k" && rangeNode.Variable == "$v"
+			},
+		},
+		{
+			name: "range with else",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{range .Values.items}}", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.}}", Line: 2, Indent: 2},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 3, Indent: 0},
+				{Type: types.TokenText, Value: "none\n", Line: 4, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 5, Indent: 0},
+				{Type: types.TokenText, Value: "after\n", Line: 6, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 2 {
+					return false
+				}
+				rangeNode, ok := nodes[0].(*RangeNode)
+				if !ok {
+					return false
+				}
+				return len(rangeNode.Body) == 1 && len(rangeNode.Else) == 1
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -677,4 +781,523 @@ func TestParseAST_With(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestParseAST_ElseChains(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokens   []types.Token
+		expected func([]Node) bool
+	}{
+		{
+			name: "if else if else",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.a}}", Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "a\n", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else if .Values.b}}", Line: 3, Indent: 0},
+				{Type: types.TokenText, Value: "b\n", Line: 4, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 5, Indent: 0},
+				{Type: types.TokenText, Value: "c\n", Line: 6, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 7, Indent: 0},
+				{Type: types.TokenText, Value: "after\n", Line: 8, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 2 {
+					return false
+				}
+				ifNode, ok := nodes[0].(*IfNode)
+				if !ok || len(ifNode.Then) != 1 || len(ifNode.Else) != 1 {
+					return false
+				}
+				elseIf, ok := ifNode.Else[0].(*IfNode)
+				if !ok || elseIf.Condition != ".Values.b" {
+					return false
+				}
+				if len(elseIf.Then) != 1 || len(elseIf.Else) != 1 {
+					return false
+				}
+				_, ok = nodes[1].(*TextNode)
+				return ok
+			},
+		},
+		{
+			name: "long else if chain without final else",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if eq .Values.n 1}}", Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "one\n", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else if eq .Values.n 2}}", Line: 3, Indent: 0},
+				{Type: types.TokenText, Value: "two\n", Line: 4, Indent: 0},
+				{Type: types.TokenElse, Value: "{{- else if eq .Values.n 3 }}", Line: 5, Indent: 0, TrimLeft: true},
+				{Type: types.TokenText, Value: "three\n", Line: 6, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else if eq .Values.n 4}}", Line: 7, Indent: 0},
+				{Type: types.TokenText, Value: "four\n", Line: 8, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 9, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				depth := 0
+				node := nodes[0]
+				for {
+					ifNode, ok := node.(*IfNode)
+					if !ok || len(ifNode.Then) != 1 {
+						return false
+					}
+					depth++
+					if len(ifNode.Else) == 0 {
+						break
+					}
+					node = ifNode.Else[0]
+				}
+				return depth == 4
+			},
+		},
+		{
+			name: "with else with",
+			tokens: []types.Token{
+				{Type: types.TokenWith, Value: "{{with .Values.primary}}", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.host}}", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else with .Values.fallback}}", Line: 3, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.host}}", Line: 4, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 5, Indent: 0},
+				{Type: types.TokenText, Value: "localhost", Line: 6, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 7, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				withNode, ok := nodes[0].(*WithNode)
+				if !ok || withNode.Expression != ".Values.primary" || len(withNode.Else) != 1 {
+					return false
+				}
+				elseWith, ok := withNode.Else[0].(*WithNode)
+				if !ok || elseWith.Expression != ".Values.fallback" {
+					return false
+				}
+				return len(elseWith.Body) == 1 && len(elseWith.Else) == 1
+			},
+		},
+		{
+			name: "if else with",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.override}}", Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "override", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else with .Values.config}}", Line: 3, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.name}}", Line: 4, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 5, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				ifNode, ok := nodes[0].(*IfNode)
+				if !ok || len(ifNode.Else) != 1 {
+					return false
+				}
+				withNode, ok := ifNode.Else[0].(*WithNode)
+				return ok && withNode.Expression == ".Values.config" && len(withNode.Else) == 0
+			},
+		},
+		{
+			name: "else if chain nested inside if",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.outer}}", Line: 1, Indent: 0},
+				{Type: types.TokenIf, Value: "{{if .Values.a}}", Line: 2, Indent: 0},
+				{Type: types.TokenText, Value: "a", Line: 3, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else if .Values.b}}", Line: 4, Indent: 0},
+				{Type: types.TokenText, Value: "b", Line: 5, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 6, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 7, Indent: 0},
+				{Type: types.TokenText, Value: "no outer", Line: 8, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 9, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				outer, ok := nodes[0].(*IfNode)
+				if !ok || len(outer.Then) != 1 || len(outer.Else) != 1 {
+					return false
+				}
+				inner, ok := outer.Then[0].(*IfNode)
+				if !ok || len(inner.Else) != 1 {
+					return false
+				}
+				_, ok = outer.Else[0].(*TextNode)
+				return ok
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := ParseAST(tt.tokens)
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			if !tt.expected(nodes) {
+				t.Errorf("Parsed nodes did not match expected structure")
+			}
+		})
+	}
+}
+
+func TestParseAST_Define(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokens   []types.Token
+		expected func([]Node) bool
+	}{
+		{
+			name: "define block",
+			tokens: []types.Token{
+				{Type: types.TokenDefine, Value: `{{define "app.name"}}`, Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "name: ", Line: 2, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.Chart.Name}}", Line: 2, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+				{Type: types.TokenText, Value: "after\n", Line: 4, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 2 {
+					return false
+				}
+				defineNode, ok := nodes[0].(*DefineNode)
+				if !ok {
+					return false
+				}
+				return defineNode.Name == "app.name" && len(defineNode.Body) == 2
+			},
+		},
+		{
+			name: "define with nested if",
+			tokens: []types.Token{
+				{Type: types.TokenDefine, Value: "{{define `labels`}}", Line: 1, Indent: 0},
+				{Type: types.TokenIf, Value: "{{if .Values.enabled}}", Line: 2, Indent: 0},
+				{Type: types.TokenText, Value: "enabled: true\n", Line: 3, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 5, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				defineNode, ok := nodes[0].(*DefineNode)
+				if !ok || defineNode.Name != "labels" || len(defineNode.Body) != 1 {
+					return false
+				}
+				_, ok = defineNode.Body[0].(*IfNode)
+				return ok
+			},
+		},
+		{
+			name: "trim markers on define apply to its body",
+			tokens: []types.Token{
+				{Type: types.TokenDefine, Value: `{{define "x"}}`, Line: 1, Indent: 0, TrimLeft: true, TrimRight: true},
+				{Type: types.TokenText, Value: "\n  value\n", Line: 2, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0, TrimLeft: true},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				defineNode, ok := nodes[0].(*DefineNode)
+				if !ok || len(defineNode.Body) != 1 {
+					return false
+				}
+				text, ok := defineNode.Body[0].(*TextNode)
+				return ok && text.Token.Value == "value"
+			},
+		},
+		{
+			name: "template with data",
+			tokens: []types.Token{
+				{Type: types.TokenTemplate, Value: `{{template "app.name" .Values.app}}`, Line: 1, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				templateNode, ok := nodes[0].(*TemplateNode)
+				return ok && templateNode.Name == "app.name" && templateNode.Pipeline == ".Values.app"
+			},
+		},
+		{
+			name: "template without data",
+			tokens: []types.Token{
+				{Type: types.TokenTemplate, Value: `{{template "app.name"}}`, Line: 1, Indent: 0},
+			},
+			expected: func(nodes []Node) bool {
+				if len(nodes) != 1 {
+					return false
+				}
+				templateNode, ok := nodes[0].(*TemplateNode)
+				return ok && templateNode.Name == "app.name" && templateNode.Pipeline == ""
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := ParseAST(tt.tokens)
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			if !tt.expected(nodes) {
+				t.Errorf("Parsed nodes did not match expected structure")
+			}
+		})
+	}
+}
+
+func TestParseAST_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []types.Token
+		wantErr string
+	}{
+		{
+			name: "if without end",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.enabled}}", Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "enabled\n", Line: 2, Indent: 0},
+			},
+			wantErr: "line 1: unexpected EOF: if has no matching {{end}}",
+		},
+		{
+			name: "unexpected end",
+			tokens: []types.Token{
+				{Type: types.TokenText, Value: "a\n", Line: 1, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 2, Indent: 0},
+			},
+			wantErr: "line 2: unexpected {{end}}",
+		},
+		{
+			name: "second else in if",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.a}}", Line: 1, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else}}", Line: 3, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
+			},
+			wantErr: "line 3: unexpected {{else}} in if",
+		},
+		{
+			name: "missing if condition",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if}}", Line: 1, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 1, Indent: 0},
+			},
+			wantErr: "line 1: missing value for if",
+		},
+		{
+			name: "missing else if condition",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: "{{if .Values.a}}", Line: 1, Indent: 0},
+				{Type: types.TokenElse, Value: "{{else if}}", Line: 2, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			wantErr: "line 2: missing value for if",
+		},
+		{
+			name: "missing else with expression",
+			tokens: []types.Token{
+				{Type: types.TokenWith, Value: "{{with .Values.a}}", Line: 1, Indent: 0},
+				{Type: types.TokenElse, Value: "{{- else with -}}", Line: 2, Indent: 0, TrimLeft: true, TrimRight: true},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			wantErr: "line 2: missing value for with",
+		},
+		{
+			name: "missing range expression",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{range $i, $v := }}", Line: 1, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 1, Indent: 0},
+			},
+			wantErr: "line 1: missing value for range",
+		},
+		{
+			name: "unbalanced parentheses in action",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: "{{ (default 1 .Values.x }}", Line: 5, Indent: 0},
+			},
+			wantErr: "line 5: unclosed left paren",
+		},
+		{
+			name: "unclosed comment",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: "{{/* note }}", Line: 2, Indent: 0},
+			},
+			wantErr: "line 2: unclosed comment",
+		},
+		{
+			name: "define without end",
+			tokens: []types.Token{
+				{Type: types.TokenDefine, Value: `{{define "x"}}`, Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "body", Line: 1, Indent: 0},
+			},
+			wantErr: "line 1: unexpected EOF: define has no matching {{end}}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAST(tt.tokens)
+			if err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected [][]ArgType
+		decl     []string
+		isAssign bool
+		wantErr  bool
+	}{
+		{
+			name:     "single field",
+			expr:     ".Values.name",
+			expected: [][]ArgType{{ArgField}},
+		},
+		{
+			name:     "field piped into functions",
+			expr:     `.Values.image.tag | default .Chart.AppVersion | quote`,
+			expected: [][]ArgType{{ArgField}, {ArgIdent, ArgField}, {ArgIdent}},
+		},
+		{
+			name:     "literals",
+			expr:     `printf "%s %d" "a b" 3 | eq true nil`,
+			expected: [][]ArgType{{ArgIdent, ArgString, ArgString, ArgNumber}, {ArgIdent, ArgBool, ArgNil}},
+		},
+		{
+			name:     "pipe inside string literal",
+			expr:     `"a|b" | upper`,
+			expected: [][]ArgType{{ArgString}, {ArgIdent}},
+		},
+		{
+			name:     "root variable",
+			expr:     `$.Values.name | lower`,
+			expected: [][]ArgType{{ArgVariable}, {ArgIdent}},
+		},
+		{
+			name:     "variable declaration",
+			expr:     `$name := .Values.name | upper`,
+			expected: [][]ArgType{{ArgField}, {ArgIdent}},
+			decl:     []string{"$name"},
+		},
+		{
+			name:     "variable assignment",
+			expr:     `$count = add $count 1`,
+			expected: [][]ArgType{{ArgIdent, ArgVariable, ArgNumber}},
+			decl:     []string{"$count"},
+			isAssign: true,
+		},
+		{
+			name:     "variable field is not a declaration",
+			expr:     `$cfg.name`,
+			expected: [][]ArgType{{ArgVariable}},
+		},
+		{
+			name:    "too many declarations outside range",
+			expr:    `$a, $b := .Values.list`,
+			wantErr: true,
+		},
+		{
+			name:     "parenthesized sub-pipelines",
+			expr:     `and (eq .Values.env "prod") (not .Values.debug)`,
+			expected: [][]ArgType{{ArgIdent, ArgPipeline, ArgPipeline}},
+		},
+		{
+			name:     "pipe inside parentheses",
+			expr:     `(.Values.name | default "x") | quote`,
+			expected: [][]ArgType{{ArgPipeline}, {ArgIdent}},
+		},
+		{
+			name:     "field access on parenthesized pipeline",
+			expr:     `(index .Values.list 0).name`,
+			expected: [][]ArgType{{ArgPipeline}},
+		},
+		{
+			name:     "nested parentheses with spaces in strings",
+			expr:     `or (and .Values.a (eq .Values.b "x (y)")) .Values.c`,
+			expected: [][]ArgType{{ArgIdent, ArgPipeline, ArgField}},
+		},
+		{
+			name:    "unclosed paren",
+			expr:    `and (.Values.a .Values.b`,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected right paren",
+			expr:    `and .Values.a) .Values.b`,
+			wantErr: true,
+		},
+		{
+			name:    "empty parentheses",
+			expr:    `not ()`,
+			wantErr: true,
+		},
+		{
+			name:    "empty stage",
+			expr:    `.Values.name | `,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			expr:    `quote "abc`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe, err := ParsePipeline(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(pipe.Decl, tt.decl) || pipe.IsAssign != tt.isAssign {
+				t.Errorf("expected declaration %v (assign %v), got %v (assign %v)", tt.decl, tt.isAssign, pipe.Decl, pipe.IsAssign)
+			}
+			if len(pipe.Cmds) != len(tt.expected) {
+				t.Fatalf("expected %d commands, got %d", len(tt.expected), len(pipe.Cmds))
+			}
+			for i, cmd := range pipe.Cmds {
+				if len(cmd.Args) != len(tt.expected[i]) {
+					t.Fatalf("command %d: expected %d args, got %d", i, len(tt.expected[i]), len(cmd.Args))
+				}
+				for j, arg := range cmd.Args {
+					if arg.Type != tt.expected[i][j] {
+						t.Errorf("command %d arg %d: expected type %d, got %d", i, j, tt.expected[i][j], arg.Type)
+					}
+				}
+			}
+		})
+	}
+}
+
+// condArgs returns the source text of the arguments of an if condition made
+// of a single command
+func condArgs(n *IfNode) []string {
+	if n.Pipe == nil || len(n.Pipe.Cmds) != 1 {
+		return nil
+	}
+	var args []string
+	for _, arg := range n.Pipe.Cmds[0].Args {
+		args = append(args, arg.Value)
+	}
+	return args
+}
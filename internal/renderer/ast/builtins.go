@@ -0,0 +1,202 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+
+	"helmish/internal/renderer/types"
+)
+
+// builtins holds the functions every Go template has access to. Functions
+// registered in the EvalContext take precedence over these. and and or are
+// not functions here: they short-circuit, so Command.evalLogical evaluates
+// them.
+var builtins types.FuncMap
+
+func init() {
+	builtins = types.FuncMap{
+		"not":     builtinNot,
+		"eq":      builtinEq,
+		"ne":      builtinNe,
+		"lt":      builtinCompare("lt", func(c int) bool { return c < 0 }),
+		"le":      builtinCompare("le", func(c int) bool { return c <= 0 }),
+		"gt":      builtinCompare("gt", func(c int) bool { return c > 0 }),
+		"ge":      builtinCompare("ge", func(c int) bool { return c >= 0 }),
+		"len":     builtinLen,
+		"index":   builtinIndex,
+		"print":   func(args ...interface{}) string { return fmt.Sprint(args...) },
+		"println": func(args ...interface{}) string { return fmt.Sprintln(args...) },
+		"printf":  builtinPrintf,
+	}
+}
+
+func builtinNot(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of args: want 1 got %d", len(args))
+	}
+	return !types.IsTruthy(args[0]), nil
+}
+
+// builtinEq reports whether the first argument equals any of the others
+func builtinEq(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("missing argument for comparison")
+	}
+	for _, other := range args[1:] {
+		if valuesEqual(args[0], other) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func builtinNe(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of args: want 2 got %d", len(args))
+	}
+	return !valuesEqual(args[0], args[1]), nil
+}
+
+// builtinCompare builds an ordered comparison function from a predicate on
+// the result of compareValues
+func builtinCompare(name string, pred func(int) bool) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("wrong number of args for %s: want 2 got %d", name, len(args))
+		}
+		c, err := compareValues(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return pred(c), nil
+	}
+}
+
+func builtinLen(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of args: want 1 got %d", len(args))
+	}
+	v := reflect.ValueOf(args[0])
+	switch v.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len(), nil
+	}
+	return nil, fmt.Errorf("len of type %T", args[0])
+}
+
+// builtinIndex returns the result of indexing its first argument by the
+// following arguments, e.g. index .Values.list 1 or index .Values.map "key"
+func builtinIndex(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of args: want at least 1 got 0")
+	}
+	item := args[0]
+	for _, key := range args[1:] {
+		v := reflect.ValueOf(item)
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.String:
+			i, ok := toInt(key)
+			if !ok {
+				return nil, fmt.Errorf("cannot index slice/array with type %T", key)
+			}
+			if i < 0 || i >= v.Len() {
+				return nil, fmt.Errorf("index out of range: %d", i)
+			}
+			item = v.Index(i).Interface()
+		case reflect.Map:
+			kv := reflect.ValueOf(key)
+			if !kv.IsValid() || !kv.Type().AssignableTo(v.Type().Key()) {
+				return nil, fmt.Errorf("value has type %T; should be %s", key, v.Type().Key())
+			}
+			mv := v.MapIndex(kv)
+			if !mv.IsValid() {
+				item = nil
+				continue
+			}
+			item = mv.Interface()
+		case reflect.Invalid:
+			return nil, fmt.Errorf("index of untyped nil")
+		default:
+			return nil, fmt.Errorf("can't index item of type %T", item)
+		}
+	}
+	return item, nil
+}
+
+func builtinPrintf(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of args: want at least 1 got 0")
+	}
+	format, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("format must be a string, got %T", args[0])
+	}
+	return fmt.Sprintf(format, args[1:]...), nil
+}
+
+// valuesEqual compares two values the way eq does, treating all integer and
+// floating point kinds as numbers
+func valuesEqual(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af == bf
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two numbers or two strings, returning -1, 0 or 1
+func compareValues(a, b interface{}) (int, error) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, fmt.Errorf("incompatible types for comparison: %T and %T", a, b)
+		}
+		switch {
+		case af < bf:
+			return -1, nil
+		case af > bf:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if !aok || !bok {
+		return 0, fmt.Errorf("incompatible types for comparison: %T and %T", a, b)
+	}
+	switch {
+	case as < bs:
+		return -1, nil
+	case as > bs:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// toFloat converts any integer or floating point value to a float64
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// toInt converts an integer value to an int
+func toInt(v interface{}) (int, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,553 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"helmish/internal/renderer/types"
+)
+
+// ArgType represents the type of a pipeline command argument
+type ArgType int
+
+const (
+	ArgField    ArgType = iota // .Values.x or .
+	ArgVariable                // $ or $.Values.x
+	ArgIdent                   // function name
+	ArgString                  // "text" or `text`
+	ArgNumber                  // 42, 1.5, -3
+	ArgBool                    // true or false
+	ArgNil                     // nil
+	ArgPipeline                // (pipeline), optionally followed by .Field
+)
+
+// Arg represents a single argument of a pipeline command
+type Arg struct {
+	Type  ArgType
+	Value string      // the source text of the argument
+	Const interface{} // the decoded value for literal arguments
+	Pipe  *Pipeline   // the sub-pipeline of a parenthesized argument
+	Field string      // field path applied to the sub-pipeline result, e.g. ".name"
+}
+
+// Command represents a single stage of a pipeline: an operand, or a function
+// name followed by its arguments
+type Command struct {
+	Args []Arg
+}
+
+// Pipeline represents a sequence of commands separated by |. The result of
+// each command is passed as the last argument of the next one. A pipeline
+// may start with a variable declaration ($x := ...) or assignment ($x = ...).
+type Pipeline struct {
+	Decl     []string // variables declared or assigned by the pipeline
+	IsAssign bool     // true for $x = ..., false for $x := ...
+	Cmds     []*Command
+}
+
+// ParsePipeline parses the inside of an action (without the {{ }} delimiters)
+// into a Pipeline
+func ParsePipeline(expr string) (*Pipeline, error) {
+	decl, isAssign, rest := splitDeclaration(expr)
+	if len(decl) > 1 {
+		return nil, fmt.Errorf("too many declarations in %q", expr)
+	}
+	stages, err := splitPipeline(rest)
+	if err != nil {
+		return nil, err
+	}
+	pipe := &Pipeline{Decl: decl, IsAssign: isAssign}
+	for _, stage := range stages {
+		words, err := splitWords(stage)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("missing command in pipeline %q", expr)
+		}
+		cmd := &Command{}
+		for _, word := range words {
+			arg, err := parseArg(word)
+			if err != nil {
+				return nil, err
+			}
+			cmd.Args = append(cmd.Args, arg)
+		}
+		pipe.Cmds = append(pipe.Cmds, cmd)
+	}
+	return pipe, nil
+}
+
+// Eval evaluates the pipeline and returns the typed result of the last command
+func (p *Pipeline) Eval(ctx *types.EvalContext) (interface{}, error) {
+	var final interface{}
+	for i, cmd := range p.Cmds {
+		val, err := cmd.eval(ctx, final, i > 0)
+		if err != nil {
+			return nil, err
+		}
+		final = val
+	}
+	for _, name := range p.Decl {
+		if ctx.Vars == nil {
+			return nil, fmt.Errorf("no variable scope for %s", name)
+		}
+		if p.IsAssign {
+			if err := ctx.Vars.Assign(name, final); err != nil {
+				return nil, err
+			}
+		} else {
+			ctx.Vars.Declare(name, final)
+		}
+	}
+	return final, nil
+}
+
+// splitDeclaration splits a leading "$x :=" or "$x =" (or "$i, $v :=") off
+// a pipeline. It returns no variables when the pipeline has no declaration.
+func splitDeclaration(expr string) ([]string, bool, string) {
+	s := strings.TrimSpace(expr)
+	var vars []string
+	for strings.HasPrefix(s, "$") {
+		end := 1
+		for end < len(s) && isVariableChar(s[end]) {
+			end++
+		}
+		vars = append(vars, s[:end])
+		s = strings.TrimSpace(s[end:])
+		if !strings.HasPrefix(s, ",") {
+			break
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+	switch {
+	case len(vars) == 0:
+	case strings.HasPrefix(s, ":="):
+		return vars, false, s[2:]
+	case strings.HasPrefix(s, "=") && !strings.HasPrefix(s, "=="):
+		return vars, true, s[1:]
+	}
+	return nil, false, expr
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// eval evaluates a single command. When piped is true, final is the result of
+// the previous command and is appended to the arguments of a function call.
+func (c *Command) eval(ctx *types.EvalContext, final interface{}, piped bool) (interface{}, error) {
+	first := c.Args[0]
+	if first.Type != ArgIdent {
+		if len(c.Args) > 1 || piped {
+			return c.evalMethod(ctx, final, piped)
+		}
+		return evalArg(ctx, first)
+	}
+	if _, overridden := ctx.Funcs[first.Value]; !overridden && (first.Value == "and" || first.Value == "or") {
+		return c.evalLogical(ctx, final, piped)
+	}
+	fn, ok := lookupFunc(ctx, first.Value)
+	if !ok {
+		return nil, fmt.Errorf("function %q not defined", first.Value)
+	}
+	args := make([]interface{}, 0, len(c.Args))
+	for _, a := range c.Args[1:] {
+		val, err := evalOperand(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, val)
+	}
+	if piped {
+		args = append(args, final)
+	}
+	return callFunc(first.Value, fn, args)
+}
+
+// evalMethod evaluates a command such as .Files.Get "x", where the last
+// element of a field chain is a method that takes the remaining arguments
+func (c *Command) evalMethod(ctx *types.EvalContext, final interface{}, piped bool) (interface{}, error) {
+	first := c.Args[0]
+	idx := strings.LastIndex(first.Value, ".")
+	if (first.Type != ArgField && first.Type != ArgVariable) || idx < 0 || idx == len(first.Value)-1 {
+		return nil, fmt.Errorf("can't give argument to non-function %s", first.Value)
+	}
+	receiverPath, name := first.Value[:idx], first.Value[idx+1:]
+	if receiverPath == "" {
+		receiverPath = "."
+	}
+	receiver, err := ctx.GetValue(receiverPath)
+	if err != nil {
+		return nil, err
+	}
+	method, ok := types.Method(receiver, name)
+	if !ok {
+		return nil, fmt.Errorf("can't give argument to non-function %s", first.Value)
+	}
+	args := make([]interface{}, 0, len(c.Args))
+	for _, a := range c.Args[1:] {
+		val, err := evalOperand(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, val)
+	}
+	if piped {
+		args = append(args, final)
+	}
+	return callFunc(name, method, args)
+}
+
+// evalLogical evaluates and/or, stopping at the first argument that decides
+// the result. Like text/template, the deciding argument itself is returned
+// and the remaining arguments are not evaluated.
+func (c *Command) evalLogical(ctx *types.EvalContext, final interface{}, piped bool) (interface{}, error) {
+	isAnd := c.Args[0].Value == "and"
+	n := len(c.Args) - 1
+	if piped {
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("wrong number of args for %s: want at least 1 got 0", c.Args[0].Value)
+	}
+	var val interface{}
+	for i := 0; i < n; i++ {
+		if i < len(c.Args)-1 {
+			var err error
+			val, err = evalOperand(ctx, c.Args[i+1])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			val = final
+		}
+		if types.IsTruthy(val) != isAnd {
+			return val, nil
+		}
+	}
+	return val, nil
+}
+
+// evalOperand returns the value of a function argument. A bare function name
+// as an argument is a call without arguments.
+func evalOperand(ctx *types.EvalContext, a Arg) (interface{}, error) {
+	if a.Type == ArgIdent {
+		return (&Command{Args: []Arg{a}}).eval(ctx, nil, false)
+	}
+	return evalArg(ctx, a)
+}
+
+// lookupFunc finds a function by name, preferring the context's functions
+// over the builtins
+func lookupFunc(ctx *types.EvalContext, name string) (interface{}, bool) {
+	if fn, ok := ctx.Funcs[name]; ok {
+		return fn, true
+	}
+	fn, ok := builtins[name]
+	return fn, ok
+}
+
+// callFunc calls a template function through reflection, converting the
+// arguments to the parameter types of the function
+func callFunc(name string, fn interface{}, args []interface{}) (result interface{}, err error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	numIn := ft.NumIn()
+	if ft.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("wrong number of args for %s: want at least %d got %d", name, numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("wrong number of args for %s: want %d got %d", name, numIn, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if ft.IsVariadic() && i >= numIn-1 {
+			paramType = ft.In(numIn - 1).Elem()
+		} else {
+			paramType = ft.In(i)
+		}
+		v, err := convertArg(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("error calling %s: %v", name, err)
+		}
+		in[i] = v
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("error calling %s: %v", name, r)
+		}
+	}()
+	out := fv.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, fmt.Errorf("error calling %s: %v", name, out[1].Interface())
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// convertArg converts a value to the given parameter type. Numbers convert
+// freely between numeric kinds, nil converts to any nillable type.
+func convertArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("invalid value; expected %s", t)
+	}
+	v := reflect.ValueOf(arg)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if isNumberKind(v.Kind()) && isNumberKind(t.Kind()) {
+		return v.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("wrong type for value; expected %s; got %T", t, arg)
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// evalArg returns the value of a non-function argument
+func evalArg(ctx *types.EvalContext, a Arg) (interface{}, error) {
+	switch a.Type {
+	case ArgField, ArgVariable:
+		return ctx.GetValue(a.Value)
+	case ArgString, ArgNumber, ArgBool, ArgNil:
+		return a.Const, nil
+	case ArgPipeline:
+		val, err := a.Pipe.Eval(ctx)
+		if err != nil || a.Field == "" {
+			return val, err
+		}
+		return types.FieldPath(val, a.Field)
+	default:
+		return nil, fmt.Errorf("unexpected argument %s", a.Value)
+	}
+}
+
+// actionInner strips the {{ }} delimiters and whitespace control markers from
+// an action, returning the inner expression
+func actionInner(action string) string {
+	inner := strings.TrimPrefix(action, "{{")
+	inner = strings.TrimSuffix(inner, "}}")
+	if strings.HasPrefix(inner, "- ") || inner == "-" {
+		inner = inner[1:]
+	}
+	if strings.HasSuffix(inner, " -") {
+		inner = inner[:len(inner)-1]
+	}
+	return strings.TrimSpace(inner)
+}
+
+// splitPipeline splits an expression on | characters outside of string
+// literals and parentheses
+func splitPipeline(expr string) ([]string, error) {
+	var stages []string
+	start, depth := 0, 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '"', '`':
+			end, err := skipString(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected right paren in %q", expr)
+			}
+		case '|':
+			if depth == 0 {
+				stages = append(stages, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unclosed left paren in %q", expr)
+	}
+	return append(stages, expr[start:]), nil
+}
+
+// splitWords splits a pipeline stage on whitespace outside of string literals
+// and parentheses, so a parenthesized sub-pipeline is a single word
+func splitWords(stage string) ([]string, error) {
+	var words []string
+	i := 0
+	for i < len(stage) {
+		if isSpace(stage[i]) {
+			i++
+			continue
+		}
+		start, depth := i, 0
+		for i < len(stage) && (depth > 0 || !isSpace(stage[i])) {
+			switch stage[i] {
+			case '"', '`':
+				end, err := skipString(stage, i)
+				if err != nil {
+					return nil, err
+				}
+				i = end
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth < 0 {
+					return nil, fmt.Errorf("unexpected right paren in %q", stage)
+				}
+			}
+			i++
+		}
+		if depth > 0 {
+			return nil, fmt.Errorf("unclosed left paren in %q", stage)
+		}
+		words = append(words, stage[start:i])
+	}
+	return words, nil
+}
+
+// matchParen returns the index of the parenthesis closing the one at start
+func matchParen(s string, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"', '`':
+			end, err := skipString(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed left paren in %q", s)
+}
+
+// skipString returns the index of the closing quote of the string literal
+// starting at start
+func skipString(s string, start int) (int, error) {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string in %q", s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parseArg classifies a single word of a pipeline command
+func parseArg(word string) (Arg, error) {
+	switch {
+	case strings.HasPrefix(word, "("):
+		end, err := matchParen(word, 0)
+		if err != nil {
+			return Arg{}, err
+		}
+		field := word[end+1:]
+		if field != "" && !strings.HasPrefix(field, ".") {
+			return Arg{}, fmt.Errorf("unexpected %q after parenthesized pipeline", field)
+		}
+		if strings.TrimSpace(word[1:end]) == "" {
+			return Arg{}, fmt.Errorf("missing pipeline in %q", word)
+		}
+		pipe, err := ParsePipeline(word[1:end])
+		if err != nil {
+			return Arg{}, err
+		}
+		return Arg{Type: ArgPipeline, Value: word, Pipe: pipe, Field: field}, nil
+	case strings.HasPrefix(word, "."):
+		return Arg{Type: ArgField, Value: word}, nil
+	case strings.HasPrefix(word, "$"):
+		return Arg{Type: ArgVariable, Value: word}, nil
+	case strings.HasPrefix(word, "\"") || strings.HasPrefix(word, "`"):
+		s, err := strconv.Unquote(word)
+		if err != nil {
+			return Arg{}, fmt.Errorf("invalid string literal %s", word)
+		}
+		return Arg{Type: ArgString, Value: word, Const: s}, nil
+	case word == "true" || word == "false":
+		return Arg{Type: ArgBool, Value: word, Const: word == "true"}, nil
+	case word == "nil":
+		return Arg{Type: ArgNil, Value: word}, nil
+	case isNumberStart(word):
+		n, err := parseNumber(word)
+		if err != nil {
+			return Arg{}, err
+		}
+		return Arg{Type: ArgNumber, Value: word, Const: n}, nil
+	case isIdentifier(word):
+		return Arg{Type: ArgIdent, Value: word}, nil
+	default:
+		return Arg{}, fmt.Errorf("unexpected %q in pipeline", word)
+	}
+}
+
+func isNumberStart(word string) bool {
+	if word == "" {
+		return false
+	}
+	c := word[0]
+	if c == '-' || c == '+' {
+		return len(word) > 1 && word[1] >= '0' && word[1] <= '9'
+	}
+	return c >= '0' && c <= '9'
+}
+
+// parseNumber parses an integer or floating point literal
+func parseNumber(word string) (interface{}, error) {
+	if i, err := strconv.ParseInt(word, 0, 64); err == nil {
+		return int(i), nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid number %s", word)
+}
+
+func isIdentifier(word string) bool {
+	for i, r := range word {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return word != ""
+}
@@ -0,0 +1,337 @@
+package renderer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"helmish/internal/renderer/types"
+	helmvalues "helmish/internal/renderer/values"
+)
+
+// dependency is an entry of the dependencies list of a Chart.yaml
+type dependency struct {
+	Name         string        `yaml:"name"`
+	Condition    string        `yaml:"condition"`
+	Tags         []string      `yaml:"tags"`
+	Alias        string        `yaml:"alias"`
+	ImportValues []interface{} `yaml:"import-values"`
+}
+
+// chartDependencies returns the dependencies listed in the Chart.yaml of a
+// chart
+func chartDependencies(chart types.Chart) ([]dependency, error) {
+	meta, ok := chart.Metadata["Chart.yaml"]
+	if !ok {
+		return nil, nil
+	}
+	var file struct {
+		Dependencies []dependency `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal([]byte(meta.Raw), &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(chart.Path, "Chart.yaml"), err)
+	}
+	return file.Dependencies, nil
+}
+
+// chartNode is a chart of the dependency tree of a render
+type chartNode struct {
+	chart    types.Chart
+	name     string      // the key of the chart's values in its parent: its alias or name
+	path     string      // path from the top-level chart, e.g. charts/redis
+	dep      *dependency // the Chart.yaml entry of the chart, nil if it has none
+	children []*chartNode
+}
+
+// buildTree matches the subcharts of a chart with the dependencies listed in
+// its Chart.yaml. A dependency with an alias is a copy of the subchart known
+// by the alias, so a subchart may be used several times. Subcharts that are
+// not listed are always included.
+func buildTree(chart types.Chart, name, chartPath string) (*chartNode, error) {
+	node := &chartNode{chart: chart, name: name, path: chartPath}
+	deps, err := chartDependencies(chart)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool)
+	for i := range deps {
+		d := &deps[i]
+		sub, ok := findSubchart(chart, d.Name)
+		if !ok {
+			return nil, fmt.Errorf("%s: dependency %q found in Chart.yaml, but missing in charts/ directory", filepath.Join(chart.Path, "Chart.yaml"), d.Name)
+		}
+		listed[d.Name] = true
+		childName := d.Name
+		if d.Alias != "" {
+			childName = d.Alias
+		}
+		child, err := buildTree(sub, childName, path.Join(chartPath, "charts", childName))
+		if err != nil {
+			return nil, err
+		}
+		child.dep = d
+		node.children = append(node.children, child)
+	}
+	for _, sub := range chart.Dependencies {
+		subName := subchartName(sub)
+		if listed[subName] {
+			continue
+		}
+		child, err := buildTree(sub, subName, path.Join(chartPath, "charts", subName))
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+	}
+	return node, nil
+}
+
+// findSubchart returns the subchart with the given name
+func findSubchart(chart types.Chart, name string) (types.Chart, bool) {
+	for _, sub := range chart.Dependencies {
+		if subchartName(sub) == name {
+			return sub, true
+		}
+	}
+	return types.Chart{}, false
+}
+
+// subchartName returns the name of a subchart: the name in its Chart.yaml,
+// or else its directory name
+func subchartName(chart types.Chart) string {
+	if name := chartName(chartMetadata(chart)); name != "" {
+		return name
+	}
+	return filepath.Base(chart.Path)
+}
+
+// defaults returns the default values of the chart. The defaults of each
+// subchart are included under its name, overridden by what the parent's
+// values.yaml sets there.
+func (n *chartNode) defaults() map[string]interface{} {
+	var defaults map[string]interface{}
+	if val, ok := n.chart.Values[DefaultValuesFile]; ok {
+		defaults, _ = val.Parsed.(map[string]interface{})
+	}
+	if len(n.children) == 0 {
+		return defaults
+	}
+	defaults = helmvalues.Merge(nil, defaults)
+	for _, c := range n.children {
+		parent, ok := defaults[c.name].(map[string]interface{})
+		if !ok && defaults[c.name] != nil {
+			// Not a map, so there is nothing to merge the defaults into
+			continue
+		}
+		defaults[c.name] = helmvalues.Coalesce(c.defaults(), parent)
+	}
+	return defaults
+}
+
+// prune drops the subcharts disabled by their condition or tags, given the
+// values of the chart and the top-level tags, and records the status of
+// every subchart it visits in deps
+func (n *chartNode) prune(values, tags map[string]interface{}, deps *[]types.Dependency) {
+	var enabled []*chartNode
+	for _, c := range n.children {
+		on := c.enabled(values, tags)
+		dep := types.Dependency{Name: subchartName(c.chart), Path: c.path, Enabled: on}
+		if c.dep != nil {
+			dep.Alias = c.dep.Alias
+		}
+		*deps = append(*deps, dep)
+		if !on {
+			continue
+		}
+		scoped, _ := values[c.name].(map[string]interface{})
+		c.prune(scoped, tags, deps)
+		enabled = append(enabled, c)
+	}
+	n.children = enabled
+}
+
+// enabled evaluates the condition and tags of a subchart against the values
+// of its parent. The first condition path that holds a boolean decides.
+// Otherwise a tag set to true enables the subchart, and tags that are only
+// set to false disable it.
+func (n *chartNode) enabled(parentValues, tags map[string]interface{}) bool {
+	if n.dep == nil {
+		return true
+	}
+	for _, cond := range strings.Split(n.dep.Condition, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		if v, ok := lookupPath(parentValues, cond).(bool); ok {
+			return v
+		}
+	}
+	hasTrue, hasFalse := false, false
+	for _, tag := range n.dep.Tags {
+		switch tags[tag] {
+		case true:
+			hasTrue = true
+		case false:
+			hasFalse = true
+		}
+	}
+	return hasTrue || !hasFalse
+}
+
+// imports returns the values a subchart exports to its parent through the
+// import-values of its dependency. An entry is either the name of a map
+// under exports in the subchart's values, which is merged into the parent's
+// values, or a child/parent pair of dotted paths. Earlier entries win.
+func (n *chartNode) imports(childValues map[string]interface{}) map[string]interface{} {
+	var imported map[string]interface{}
+	if n.dep == nil {
+		return imported
+	}
+	for _, iv := range n.dep.ImportValues {
+		var child, parent string
+		switch v := iv.(type) {
+		case string:
+			child = "exports." + v
+		case map[string]interface{}:
+			child, _ = v["child"].(string)
+			parent, _ = v["parent"].(string)
+		}
+		table, ok := lookupPath(childValues, child).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if parent != "" && parent != "." {
+			keys := strings.Split(parent, ".")
+			for i := len(keys) - 1; i >= 0; i-- {
+				table = map[string]interface{}{keys[i]: table}
+			}
+		}
+		imported = helmvalues.Merge(table, imported)
+	}
+	return imported
+}
+
+// lookupPath returns the value at a dotted path in the values, or nil
+func lookupPath(values map[string]interface{}, dotted string) interface{} {
+	var cur interface{} = values
+	for _, key := range strings.Split(dotted, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+// resolveDependencies builds the dependency tree of a chart and drops the
+// subcharts that the user values disable
+func resolveDependencies(chart types.Chart, user map[string]interface{}) (*chartNode, []types.Dependency, error) {
+	tree, err := buildTree(chart, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	values := helmvalues.Coalesce(tree.defaults(), user)
+	tags, _ := values["tags"].(map[string]interface{})
+	deps := []types.Dependency{}
+	tree.prune(values, tags, &deps)
+	return tree, deps, nil
+}
+
+// ResolveDependencies reports the subcharts of the chart and whether the
+// values of the options enable them
+func ResolveDependencies(opts Options) ([]types.Dependency, error) {
+	user, _, err := userValues(opts)
+	if err != nil {
+		return nil, err
+	}
+	_, deps, err := resolveDependencies(opts.Chart, user)
+	return deps, err
+}
+
+// scopedChart is a chart of the dependency tree together with the values it
+// is rendered with
+type scopedChart struct {
+	chart    types.Chart
+	metadata interface{}            // the .Chart object
+	prefix   string                 // path from the top-level chart, e.g. charts/redis
+	pointer  string                 // JSON pointer of the values in the top-level values
+	values   map[string]interface{} // the .Values object
+	layers   []valuesLayer          // where the values came from
+}
+
+// outputPath returns the key of a template file of the chart in the render
+// result. Templates of subcharts are prefixed with their path, e.g.
+// charts/redis/templates/x.yaml.
+func (c scopedChart) outputPath(filename string) string {
+	if c.prefix == "" {
+		return filename
+	}
+	return path.Join(c.prefix, "templates", filepath.ToSlash(filename))
+}
+
+// scopeCharts flattens a dependency tree, parents first. Each subchart sees
+// the values under its name, with the parent's globals applied on top of
+// its own. Values imported from subcharts have a lower precedence than the
+// parent's own values. values is updated in place.
+func scopeCharts(node *chartNode, pointer string, values map[string]interface{}, layers []valuesLayer) []scopedChart {
+	metadata := chartMetadata(node.chart)
+	if node.dep != nil && node.dep.Alias != "" {
+		metadata = aliasMetadata(metadata, node.dep.Alias)
+	}
+	charts := []scopedChart{{
+		chart:    node.chart,
+		metadata: metadata,
+		prefix:   node.path,
+		pointer:  pointer,
+		values:   values,
+		layers:   layers,
+	}}
+	var imported map[string]interface{}
+	for _, c := range node.children {
+		subValues, _ := values[c.name].(map[string]interface{})
+		subValues = helmvalues.Merge(nil, subValues)
+		if global, ok := values["global"].(map[string]interface{}); ok {
+			own, _ := subValues["global"].(map[string]interface{})
+			subValues["global"] = helmvalues.Merge(own, global)
+		}
+		// Like helm, the parent sees the subchart's values as the subchart
+		// does, globals included
+		if _, ok := values[c.name].(map[string]interface{}); ok || values[c.name] == nil {
+			values[c.name] = subValues
+		}
+		subLayers := []valuesLayer{{source: "chart " + path.Join(c.path, DefaultValuesFile), values: c.defaults()}}
+		for _, l := range layers {
+			scoped, _ := l.values[c.name].(map[string]interface{})
+			subLayers = append(subLayers, valuesLayer{source: l.source, values: scoped})
+		}
+		charts = append(charts, scopeCharts(c, pointer+"/"+c.name, subValues, subLayers)...)
+		imported = helmvalues.Merge(c.imports(subValues), imported)
+	}
+	if len(imported) > 0 {
+		merged := helmvalues.Coalesce(imported, values)
+		for k := range values {
+			delete(values, k)
+		}
+		for k, v := range merged {
+			values[k] = v
+		}
+	}
+	return charts
+}
+
+// aliasMetadata returns a copy of the normalized chart metadata named after
+// the alias, like helm does for the .Chart of an aliased subchart
+func aliasMetadata(metadata interface{}, alias string) interface{} {
+	m, _ := metadata.(map[string]interface{})
+	out := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out["Name"] = alias
+	return out
+}
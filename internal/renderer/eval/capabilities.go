@@ -0,0 +1,118 @@
+package eval
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"helmish/internal/renderer/types"
+)
+
+// helmVersion is the Helm version reported as .Capabilities.HelmVersion
+const helmVersion = "v3.16.0"
+
+// defaultKubeVersion is used when a profile does not name a Kubernetes
+// version, matching the client version of helmVersion
+const defaultKubeVersion = "v1.31.0"
+
+// defaultAPIVersions is used when a profile lists no API versions. Like
+// Helm's default set it holds the built-in API versions of Kubernetes.
+var defaultAPIVersions = []string{
+	"v1",
+	"admissionregistration.k8s.io/v1",
+	"apiextensions.k8s.io/v1",
+	"apiregistration.k8s.io/v1",
+	"apps/v1",
+	"authentication.k8s.io/v1",
+	"authorization.k8s.io/v1",
+	"autoscaling/v1",
+	"autoscaling/v2",
+	"batch/v1",
+	"certificates.k8s.io/v1",
+	"coordination.k8s.io/v1",
+	"discovery.k8s.io/v1",
+	"events.k8s.io/v1",
+	"flowcontrol.apiserver.k8s.io/v1",
+	"networking.k8s.io/v1",
+	"node.k8s.io/v1",
+	"policy/v1",
+	"rbac.authorization.k8s.io/v1",
+	"scheduling.k8s.io/v1",
+	"storage.k8s.io/v1",
+}
+
+// Capabilities is the .Capabilities object of the template root
+type Capabilities struct {
+	KubeVersion KubeVersion
+	APIVersions VersionSet
+	HelmVersion HelmVersion
+}
+
+// KubeVersion is the Kubernetes version of the target cluster
+type KubeVersion struct {
+	Version string // e.g. v1.25.0
+	Major   string // e.g. 1
+	Minor   string // e.g. 25
+}
+
+// String returns the full version
+func (kv KubeVersion) String() string { return kv.Version }
+
+// GitVersion returns the full version. Helm deprecated it in favour of
+// Version, but older charts still use it.
+func (kv KubeVersion) GitVersion() string { return kv.Version }
+
+// VersionSet is the set of API versions available in the target cluster
+type VersionSet []string
+
+// Has reports whether the set contains the API version, written as
+// group/version or group/version/Kind
+func (v VersionSet) Has(apiVersion string) bool {
+	for _, version := range v {
+		if version == apiVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// HelmVersion describes the Helm version charts are rendered for
+type HelmVersion struct {
+	Version      string
+	GitCommit    string
+	GitTreeState string
+	GoVersion    string
+}
+
+// String returns the Helm version
+func (hv HelmVersion) String() string { return hv.Version }
+
+// NewCapabilities builds the .Capabilities object from the capabilities of a
+// profile. The Kubernetes version may omit the patch or minor part and the
+// leading v, e.g. "1.25"; like Helm it is reported in full, keeping any
+// pre-release and build metadata. Empty settings fall back to the defaults.
+func NewCapabilities(c types.Capabilities) (*Capabilities, error) {
+	if c.KubeVersion == "" {
+		c.KubeVersion = defaultKubeVersion
+	}
+	if c.APIVersions == nil {
+		c.APIVersions = defaultAPIVersions
+	}
+	v, err := parseSemver(c.KubeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kube version %q: %v", c.KubeVersion, err)
+	}
+	return &Capabilities{
+		KubeVersion: KubeVersion{
+			Version: "v" + v.String(),
+			Major:   strconv.FormatUint(v.Major(), 10),
+			Minor:   strconv.FormatUint(v.Minor(), 10),
+		},
+		APIVersions: append(VersionSet(nil), c.APIVersions...),
+		HelmVersion: HelmVersion{
+			Version:      helmVersion,
+			GitTreeState: "clean",
+			GoVersion:    runtime.Version(),
+		},
+	}, nil
+}
@@ -102,7 +102,19 @@ func isWhitespaceOnly(s string) bool {
 	return strings.Trim(s, " \t\n\r") == ""
 }
 
-// NewEvalContext creates a new evaluation context with the given values and chart
+// NewEvalContext creates a new evaluation context whose root object holds the
+// given values and chart, with the Sprig-compatible function library
+// registered and an empty named template table
 func NewEvalContext(values, chart interface{}) *types.EvalContext {
-	return &types.EvalContext{Values: values, Chart: chart, Root: values}
+	root := types.NewRoot(values, chart)
+	ctx := &types.EvalContext{
+		Dot:       root,
+		Root:      root,
+		Funcs:     FuncMap(),
+		Templates: make(types.Templates),
+		Vars:      types.NewScope(nil),
+		Calls:     &types.TemplateCalls{},
+	}
+	bindTemplateFuncs(ctx)
+	return ctx
 }
\ No newline at end of file
@@ -1,11 +1,14 @@
 package eval_test
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"helmish/internal/renderer/ast"
 	"helmish/internal/renderer/eval"
+	tokens "helmish/internal/renderer/tokenizer"
 	"helmish/internal/renderer/types"
 )
 
@@ -20,6 +23,7 @@ func TestEvaluateASTIf(t *testing.T) {
 		tokens   []types.Token
 		values   map[string]interface{}
 		expected []types.Token
+		wantErr  string // the infix and/or form is not an operator, as in Go templates
 	}{
 		{
 			name: "just text tokens",
@@ -74,45 +78,37 @@ func TestEvaluateASTIf(t *testing.T) {
 			},
 		},
 		{
-			name: "text, if infix or true true",
+			name: "text, infix or is rejected (true true)",
 			tokens: []types.Token{
 				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
 				{Type: types.TokenIf, Value: "{{if .Values.a or .Values.b}}", Line: 2, Indent: 0},
 				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
 				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
 			},
-			values: map[string]interface{}{"a": true, "b": true},
-			expected: []types.Token{
-				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
-				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
-			},
+			values:  map[string]interface{}{"a": true, "b": true},
+			wantErr: "can't give argument to non-function .Values.a",
 		},
 		{
-			name: "text, if infix or true false",
+			name: "text, infix or is rejected (true false)",
 			tokens: []types.Token{
 				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
 				{Type: types.TokenIf, Value: "{{if .Values.a or .Values.b}}", Line: 2, Indent: 0},
 				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
 				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
 			},
-			values: map[string]interface{}{"a": true, "b": false},
-			expected: []types.Token{
-				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
-				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
-			},
+			values:  map[string]interface{}{"a": true, "b": false},
+			wantErr: "can't give argument to non-function .Values.a",
 		},
 		{
-			name: "text, if infix or false false",
+			name: "text, infix or is rejected (false false)",
 			tokens: []types.Token{
 				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
 				{Type: types.TokenIf, Value: "{{if .Values.a or .Values.b}}", Line: 2, Indent: 0},
 				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
 				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
 			},
-			values: map[string]interface{}{"a": false, "b": false},
-			expected: []types.Token{
-				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
-			},
+			values:  map[string]interface{}{"a": false, "b": false},
+			wantErr: "can't give argument to non-function .Values.a",
 		},
 		{
 			name: "if with and true true",
@@ -278,18 +274,15 @@ func TestEvaluateASTIf(t *testing.T) {
 			},
 		},
 		{
-			name: "if with and infix",
+			name: "infix and is rejected",
 			tokens: []types.Token{
 				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
 				{Type: types.TokenIf, Value: "{{if .Values.a and .Values.b}}", Line: 2, Indent: 0},
 				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
 				{Type: types.TokenEnd, Value: "{{end}}", Line: 4, Indent: 0},
 			},
-			values: map[string]interface{}{"a": true, "b": true},
-			expected: []types.Token{
-				{Type: types.TokenText, Value: "data:\n", Line: 1, Indent: 0},
-				{Type: types.TokenText, Value: "  key: value\n", Line: 3, Indent: 2},
-			},
+			values:  map[string]interface{}{"a": true, "b": true},
+			wantErr: "can't give argument to non-function .Values.a",
 		},
 		{
 			name: "if else with or both true",
@@ -360,6 +353,12 @@ func TestEvaluateASTIf(t *testing.T) {
 				t.Fatalf("unexpected error parsing AST: %v", err)
 			}
 			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -553,6 +552,41 @@ func TestEvaluateAST_Range(t *testing.T) {
 			expectedCount: 2,
 			checkContains: "value1",
 		},
+		{
+			name: "range over map values in sorted key order",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{range .Values.config}}", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.}}", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			values: map[string]interface{}{
+				"config": map[string]interface{}{
+					"zeta":  "3",
+					"alpha": "1",
+					"mid":   "2",
+					"beta":  "1b",
+				},
+			},
+			expectedCount: 4,
+			checkContains: "11b23",
+		},
+		{
+			name: "range over interface-keyed map",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: "{{range .Values.config}}", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{.}}", Line: 2, Indent: 2},
+				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
+			},
+			values: map[string]interface{}{
+				"config": map[interface{}]interface{}{
+					"b": "second",
+					"a": "first",
+					"c": "third",
+				},
+			},
+			expectedCount: 3,
+			checkContains: "firstsecondthird",
+		},
 		{
 			name: "range with if - only show enabled users",
 			tokens: []types.Token{
@@ -1227,10 +1261,10 @@ func TestEvaluateAST_RootContext(t *testing.T) {
 			},
 		},
 		{
-			name: "$ alone inside with returns the root map",
+			name: "$.Values inside with returns the values map",
 			tokens: []types.Token{
 				{Type: types.TokenWith, Value: "{{with .Values.config}}", Line: 1, Indent: 0},
-				{Type: types.TokenAction, Value: "{{$}}", Line: 2, Indent: 2},
+				{Type: types.TokenAction, Value: "{{$.Values}}", Line: 2, Indent: 2},
 				{Type: types.TokenEnd, Value: "{{end}}", Line: 3, Indent: 0},
 			},
 			values: map[string]interface{}{
@@ -1238,7 +1272,7 @@ func TestEvaluateAST_RootContext(t *testing.T) {
 				"extra":  "data",
 			},
 			expected: []types.Token{
-				// The root map rendered as string representation
+				// The values map rendered as string representation
 				// (the ActionNode uses fmt.Sprintf("%v", resultVal))
 				{Type: types.TokenAction, Value: "map[config:map[name:myconfig] extra:data]", Line: 2, Indent: 2},
 			},
@@ -1501,4 +1535,1043 @@ func TestEvaluateAST_Trimming(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestEvaluateAST_Pipeline(t *testing.T) {
+	// Helper to create EvalContext with given values
+	createCtx := func(values map[string]interface{}) *types.EvalContext {
+		return eval.NewEvalContext(values, map[string]interface{}{"Name": "test", "AppVersion": "1.2.3"})
+	}
+
+	tests := []struct {
+		name     string
+		tokens   []types.Token
+		values   map[string]interface{}
+		expected string
+	}{
+		{
+			name: "pipeline into builtin function",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: "{{ .Values.items | len }}", Line: 1, Indent: 0},
+			},
+			values:   map[string]interface{}{"items": []interface{}{"a", "b", "c"}},
+			expected: "3",
+		},
+		{
+			name: "piped value is passed as the last argument",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: `{{ .Values.name | printf "%s-%s" .Chart.Name }}`, Line: 1, Indent: 0},
+			},
+			values:   map[string]interface{}{"name": "web"},
+			expected: "test-web",
+		},
+		{
+			name: "multi stage pipeline keeps typed values between stages",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: `{{ index .Values.ports 1 | eq 8080 | not }}`, Line: 1, Indent: 0},
+			},
+			values:   map[string]interface{}{"ports": []interface{}{80, 8080}},
+			expected: "false",
+		},
+		{
+			name: "string literal containing a pipe character",
+			tokens: []types.Token{
+				{Type: types.TokenAction, Value: `{{ "a | b" | printf "%s!" }}`, Line: 1, Indent: 0},
+			},
+			values:   map[string]interface{}{},
+			expected: "a | b!",
+		},
+		{
+			name: "pipeline in if condition",
+			tokens: []types.Token{
+				{Type: types.TokenIf, Value: `{{ if .Values.env | eq "prod" }}`, Line: 1, Indent: 0},
+				{Type: types.TokenText, Value: "prod\n", Line: 2, Indent: 0},
+				{Type: types.TokenElse, Value: "{{ else }}", Line: 3, Indent: 0},
+				{Type: types.TokenText, Value: "other\n", Line: 4, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{ end }}", Line: 5, Indent: 0},
+			},
+			values:   map[string]interface{}{"env": "prod"},
+			expected: "prod\n",
+		},
+		{
+			name: "pipeline in with header",
+			tokens: []types.Token{
+				{Type: types.TokenWith, Value: `{{ with index .Values.servers 0 }}`, Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{ .host }}", Line: 2, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{ end }}", Line: 3, Indent: 0},
+			},
+			values: map[string]interface{}{
+				"servers": []interface{}{map[string]interface{}{"host": "a.example.com"}},
+			},
+			expected: "a.example.com",
+		},
+		{
+			name: "pipeline in range header",
+			tokens: []types.Token{
+				{Type: types.TokenRange, Value: `{{ range index .Values.groups "web" }}`, Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{ . }}", Line: 2, Indent: 0},
+				{Type: types.TokenEnd, Value: "{{ end }}", Line: 3, Indent: 0},
+			},
+			values: map[string]interface{}{
+				"groups": map[string]interface{}{"web": []interface{}{"x", "y"}},
+			},
+			expected: "xy",
+		},
+		{
+			name: "missing value renders as empty string",
+			tokens: []types.Token{
+				{Type: types.TokenText, Value: "tag: ", Line: 1, Indent: 0},
+				{Type: types.TokenAction, Value: "{{ .Values.image.tag }}", Line: 1, Indent: 0},
+			},
+			values:   map[string]interface{}{"image": map[string]interface{}{}},
+			expected: "tag: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := createCtx(tt.values)
+			nodes, err := ast.ParseAST(tt.tokens)
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_NamedTemplates(t *testing.T) {
+	helpers := `{{/* common helpers */}}
+{{- define "app.name" -}}
+{{ .Chart.Name }}-app
+{{- end }}
+
+{{- define "app.labels" -}}
+app: {{ include "app.name" . }}
+tier: {{ .Values.tier }}
+{{- end }}
+
+{{- define "app.port" -}}
+{{ . }}
+{{- end }}
+`
+
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "template action",
+			template: `name: {{ template "app.name" . }}`,
+			expected: "name: test-app",
+		},
+		{
+			name:     "include returns a string",
+			template: `name: {{ include "app.name" . | upper | quote }}`,
+			expected: `name: "TEST-APP"`,
+		},
+		{
+			name:     "include feeds nindent",
+			template: `labels:{{ include "app.labels" . | nindent 2 }}`,
+			values:   map[string]interface{}{"tier": "web"},
+			expected: "labels:\n  app: test-app\n  tier: web",
+		},
+		{
+			name:     "template receives its own dot",
+			template: `port: {{ template "app.port" .Values.port }}`,
+			values:   map[string]interface{}{"port": 8080},
+			expected: "port: 8080",
+		},
+		{
+			name:     "template without data",
+			template: `{{ define "static" }}fixed{{ end }}value: {{ template "static" }}`,
+			expected: "value: fixed",
+		},
+		{
+			name:     "define in the same file is not rendered in place",
+			template: "{{- define \"local\" -}}\nlocal\n{{- end }}\nkey: {{ include \"local\" . }}",
+			expected: "\nkey: local",
+		},
+		{
+			name:     "unknown template",
+			template: `{{ include "missing" . }}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+			helperNodes, err := ast.ParseAST(tokens.TokenizeSource(helpers))
+			if err != nil {
+				t.Fatalf("unexpected error parsing helpers: %v", err)
+			}
+			eval.CollectTemplates(helperNodes, ctx.Templates)
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			eval.CollectTemplates(nodes, ctx.Templates)
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_RecursiveTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+	}{
+		{name: "include of itself", template: `{{ define "a" }}{{ include "a" . }}{{ end }}{{ include "a" . }}`},
+		{name: "template of itself", template: `{{ define "a" }}{{ template "a" . }}{{ end }}{{ template "a" . }}`},
+		{name: "mutual includes", template: `{{ define "a" }}{{ include "b" . }}{{ end }}{{ define "b" }}{{ include "a" . }}{{ end }}{{ include "a" . }}`},
+		{name: "tpl of itself", template: `{{ tpl .Values.t . }}`, values: map[string]interface{}{"t": "{{ tpl .Values.t . }}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(tt.values, nil)
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			eval.CollectTemplates(nodes, ctx.Templates)
+			_, err = eval.EvaluateAST(nodes, ctx)
+			if err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), "exceeded maximum template depth (1000)") || strings.Count(err.Error(), "error calling") > 1 {
+				t.Errorf("expected a single depth error, got %q", err)
+			}
+			if ctx.Calls.Depth != 0 || ctx.Calls.Err != nil {
+				t.Errorf("expected the calls to unwind, got depth %d and error %v", ctx.Calls.Depth, ctx.Calls.Err)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_Variables(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "declare and use",
+			template: `{{- $name := .Values.name -}}name: {{ $name }}`,
+			values:   map[string]interface{}{"name": "web"},
+			expected: "name: web",
+		},
+		{
+			name:     "declaration prints nothing",
+			template: `a{{ $x := 1 }}b`,
+			expected: "ab",
+		},
+		{
+			name:     "declare from a pipeline",
+			template: `{{ $full := printf "%s-%s" .Chart.Name .Values.name | upper }}{{ $full }}`,
+			values:   map[string]interface{}{"name": "web"},
+			expected: "TEST-WEB",
+		},
+		{
+			name:     "field access on a variable",
+			template: `{{ $img := .Values.image }}{{ $img.repo }}:{{ $img.tag }}`,
+			values:   map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "1.25"}},
+			expected: "nginx:1.25",
+		},
+		{
+			name:     "assignment updates the variable",
+			template: `{{ $x := 1 }}{{ $x = add $x 1 }}{{ $x }}`,
+			expected: "2",
+		},
+		{
+			name:     "variable in condition",
+			template: `{{ $on := .Values.enabled }}{{ if $on }}on{{ else }}off{{ end }}`,
+			values:   map[string]interface{}{"enabled": true},
+			expected: "on",
+		},
+		{
+			name:     "variable in condition pipeline",
+			template: `{{ $env := .Values.env }}{{ if eq $env "prod" }}prod{{ end }}`,
+			values:   map[string]interface{}{"env": "prod"},
+			expected: "prod",
+		},
+		{
+			name:     "outer variable visible inside with",
+			template: `{{ $prefix := .Values.prefix }}{{ with .Values.app }}{{ $prefix }}-{{ .name }}{{ end }}`,
+			values:   map[string]interface{}{"prefix": "p", "app": map[string]interface{}{"name": "web"}},
+			expected: "p-web",
+		},
+		{
+			name:     "declaration inside if is dropped at end",
+			template: `{{ if true }}{{ $inner := 1 }}{{ end }}{{ $inner }}`,
+			wantErr:  true,
+		},
+		{
+			name:     "declaration inside if shadows outer variable",
+			template: `{{ $x := "outer" }}{{ if true }}{{ $x := "inner" }}{{ $x }} {{ end }}{{ $x }}`,
+			expected: "inner outer",
+		},
+		{
+			name:     "assignment inside if is visible after end",
+			template: `{{ $x := "before" }}{{ if true }}{{ $x = "after" }}{{ end }}{{ $x }}`,
+			expected: "after",
+		},
+		{
+			name:     "assignment inside range accumulates",
+			template: `{{ $sum := 0 }}{{ range .Values.nums }}{{ $sum = add $sum . }}{{ end }}{{ $sum }}`,
+			values:   map[string]interface{}{"nums": []interface{}{1, 2, 3}},
+			expected: "6",
+		},
+		{
+			name:     "declaration in with header",
+			template: `{{ with $cfg := .Values.cfg }}{{ $cfg.a }}{{ end }}`,
+			values:   map[string]interface{}{"cfg": map[string]interface{}{"a": "x"}},
+			expected: "x",
+		},
+		{
+			name:     "variables are not visible inside named templates",
+			template: `{{ define "t" }}{{ $x }}{{ end }}{{ $x := 1 }}{{ include "t" . }}`,
+			wantErr:  true,
+		},
+		{
+			name:     "assignment to undeclared variable",
+			template: `{{ $missing = 1 }}`,
+			wantErr:  true,
+		},
+		{
+			name:     "undefined variable",
+			template: `{{ $missing }}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			eval.CollectTemplates(nodes, ctx.Templates)
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_RangeVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "value variable over list",
+			template: `{{ range $item := .Values.items }}[{{ $item }}]{{ end }}`,
+			values:   map[string]interface{}{"items": []interface{}{"a", "b"}},
+			expected: "[a][b]",
+		},
+		{
+			name:     "index and value over list",
+			template: `{{ range $i, $item := .Values.items }}{{ $i }}={{ $item }};{{ end }}`,
+			values:   map[string]interface{}{"items": []interface{}{"a", "b", "c"}},
+			expected: "0=a;1=b;2=c;",
+		},
+		{
+			name:     "dot is still the current item",
+			template: `{{ range $i, $c := .Values.containers }}{{ $i }}:{{ .name }}/{{ $c.image }} {{ end }}`,
+			values: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "nginx"},
+				map[string]interface{}{"name": "sidecar", "image": "envoy"},
+			}},
+			expected: "0:app/nginx 1:sidecar/envoy ",
+		},
+		{
+			name:     "key and value over map",
+			template: "{{- range $k, $v := .Values.env }}\n- name: {{ $k }}\n  value: {{ $v | quote }}\n{{- end }}",
+			values:   map[string]interface{}{"env": map[string]interface{}{"LOG_LEVEL": "debug"}},
+			expected: "\n- name: LOG_LEVEL\n  value: \"debug\"",
+		},
+		{
+			name:     "single variable over map is the value",
+			template: `{{ range $v := .Values.env }}{{ $v }}{{ end }}`,
+			values:   map[string]interface{}{"env": map[string]interface{}{"LOG_LEVEL": "debug"}},
+			expected: "debug",
+		},
+		{
+			name:     "map keys in sorted order",
+			template: `{{ range $k, $v := .Values.env }}{{ $k }}={{ $v }} {{ end }}`,
+			values: map[string]interface{}{"env": map[string]interface{}{
+				"PORT": 8080, "HOST": "0.0.0.0", "LOG_LEVEL": "debug", "DEBUG": false,
+			}},
+			expected: "DEBUG=false HOST=0.0.0.0 LOG_LEVEL=debug PORT=8080 ",
+		},
+		{
+			name:     "integer keys sort numerically",
+			template: `{{ range $k, $v := .Values.codes }}{{ $k }}:{{ $v }} {{ end }}`,
+			values: map[string]interface{}{"codes": map[interface{}]interface{}{
+				404: "not found", 200: "ok", 1000: "custom", 50: "low",
+			}},
+			expected: "50:low 200:ok 404:not found 1000:custom ",
+		},
+		{
+			name:     "string-valued typed map",
+			template: `{{ range $k, $v := .Values.labels }}{{ $k }}={{ $v }},{{ end }}`,
+			values:   map[string]interface{}{"labels": map[string]string{"tier": "web", "app": "x"}},
+			expected: "app=x,tier=web,",
+		},
+		{
+			name:     "integer range",
+			template: `{{ range $i := 3 }}{{ $i }}{{ end }}`,
+			expected: "012",
+		},
+		{
+			name:     "integer range from values",
+			template: `{{ range $i, $n := .Values.replicas }}{{ $i }}{{ $n }} {{ end }}`,
+			values:   map[string]interface{}{"replicas": 2},
+			expected: "00 11 ",
+		},
+		{
+			name:     "typed slice from a function",
+			template: `{{ range $i, $p := splitList "," "a,b" }}{{ $i }}{{ $p }}{{ end }}`,
+			expected: "0a1b",
+		},
+		{
+			name:     "outer variables and root inside range",
+			template: `{{ $prefix := "x" }}{{ range $v := .Values.items }}{{ $prefix }}{{ $v }}{{ $.Values.suffix }} {{ end }}`,
+			values:   map[string]interface{}{"items": []interface{}{1, 2}, "suffix": "!"},
+			expected: "x1! x2! ",
+		},
+		{
+			name:     "range variables are not visible after end",
+			template: `{{ range $i, $v := .Values.items }}{{ end }}{{ $v }}`,
+			values:   map[string]interface{}{"items": []interface{}{1}},
+			wantErr:  true,
+		},
+		{
+			name:     "too many range variables",
+			template: `{{ range $a, $b, $c := .Values.items }}{{ end }}`,
+			values:   map[string]interface{}{"items": []interface{}{1}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			var result []types.Token
+			if err == nil {
+				result, err = eval.EvaluateAST(nodes, ctx)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_ElseChains(t *testing.T) {
+	chain := `{{ if eq .Values.size "s" }}small{{ else if eq .Values.size "m" }}medium{{ else if eq .Values.size "l" }}large{{ else }}unknown{{ end }}`
+	withChain := `{{ with .Values.primary }}{{ .host }}{{ else with .Values.fallback }}{{ .host }}{{ else }}localhost{{ end }}`
+
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+	}{
+		{name: "first branch", template: chain, values: map[string]interface{}{"size": "s"}, expected: "small"},
+		{name: "second branch", template: chain, values: map[string]interface{}{"size": "m"}, expected: "medium"},
+		{name: "third branch", template: chain, values: map[string]interface{}{"size": "l"}, expected: "large"},
+		{name: "final else", template: chain, values: map[string]interface{}{"size": "xl"}, expected: "unknown"},
+		{
+			name:     "with chain uses primary",
+			template: withChain,
+			values:   map[string]interface{}{"primary": map[string]interface{}{"host": "a"}, "fallback": map[string]interface{}{"host": "b"}},
+			expected: "a",
+		},
+		{
+			name:     "with chain falls back",
+			template: withChain,
+			values:   map[string]interface{}{"fallback": map[string]interface{}{"host": "b"}},
+			expected: "b",
+		},
+		{
+			name:     "with chain final else",
+			template: withChain,
+			values:   map[string]interface{}{},
+			expected: "localhost",
+		},
+		{
+			name:     "if else with",
+			template: `{{ if .Values.name }}{{ .Values.name }}{{ else with .Values.config }}{{ .name }}{{ end }}`,
+			values:   map[string]interface{}{"config": map[string]interface{}{"name": "from-config"}},
+			expected: "from-config",
+		},
+		{
+			name:     "trimmed chain",
+			template: "x:\n{{- if .Values.a }}\n  a\n{{- else if .Values.b }}\n  b\n{{- end }}\ny",
+			values:   map[string]interface{}{"b": true},
+			expected: "x:\n  b\ny",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(tt.values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_RangeElse(t *testing.T) {
+	tmpl := `{{ range .Values.items }}[{{ . }}]{{ else }}none{{ end }}`
+
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		wantErr  bool
+	}{
+		{name: "non-empty list", template: tmpl, values: map[string]interface{}{"items": []interface{}{"a", "b"}}, expected: "[a][b]"},
+		{name: "empty list", template: tmpl, values: map[string]interface{}{"items": []interface{}{}}, expected: "none"},
+		{name: "missing value", template: tmpl, values: map[string]interface{}{}, expected: "none"},
+		{name: "explicit null", template: tmpl, values: map[string]interface{}{"items": nil}, expected: "none"},
+		{name: "empty map", template: tmpl, values: map[string]interface{}{"items": map[string]interface{}{}}, expected: "none"},
+		{name: "zero integer", template: tmpl, values: map[string]interface{}{"items": 0}, expected: "none"},
+		{
+			name:     "else keeps the outer dot",
+			template: `{{ range .Values.items }}{{ . }}{{ else }}{{ .Values.fallback }}{{ end }}`,
+			values:   map[string]interface{}{"fallback": "default"},
+			expected: "default",
+		},
+		{
+			name:     "range with variables and else",
+			template: `{{ range $k, $v := .Values.env }}{{ $k }}={{ $v }}{{ else }}no env{{ end }}`,
+			values:   map[string]interface{}{"env": map[string]interface{}{}},
+			expected: "no env",
+		},
+		{
+			name:     "trimmed else",
+			template: "items:\n{{- range .Values.items }}\n- {{ . }}\n{{- else }} []\n{{- end }}",
+			values:   map[string]interface{}{},
+			expected: "items: []",
+		},
+		{name: "string is not iterable", template: tmpl, values: map[string]interface{}{"items": "abc"}, wantErr: true},
+		{name: "bool is not iterable", template: tmpl, values: map[string]interface{}{"items": true}, wantErr: true},
+		{name: "float is not iterable", template: tmpl, values: map[string]interface{}{"items": 1.5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(tt.values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_Conditions(t *testing.T) {
+	values := map[string]interface{}{
+		"env":      "prod",
+		"region":   "eu west",
+		"replicas": 3,
+		"ratio":    0.5,
+		"enabled":  true,
+		"debug":    false,
+		"tags":     []interface{}{"a", "b"},
+		"image":    map[string]interface{}{"tag": "1.2.3"},
+		"empty":    "",
+	}
+
+	tests := []struct {
+		name     string
+		cond     string
+		expected bool
+		wantErr  bool
+	}{
+		{name: "eq string", cond: `eq .Values.env "prod"`, expected: true},
+		{name: "eq string literal with spaces", cond: `eq .Values.region "eu west"`, expected: true},
+		{name: "eq any of several", cond: `eq .Values.env "dev" "staging" "prod"`, expected: true},
+		{name: "ne", cond: `ne .Values.env "dev"`, expected: true},
+		{name: "lt int", cond: `lt .Values.replicas 5`, expected: true},
+		{name: "le int", cond: `le .Values.replicas 3`, expected: true},
+		{name: "gt int", cond: `gt .Values.replicas 3`, expected: false},
+		{name: "ge float", cond: `ge .Values.ratio 0.5`, expected: true},
+		{name: "compare strings", cond: `lt "abc" "abd"`, expected: true},
+		{name: "bool literal", cond: `true`, expected: true},
+		{name: "zero is falsy", cond: `0`, expected: false},
+		{name: "non-zero number is truthy", cond: `1`, expected: true},
+		{name: "string false is truthy", cond: `"false"`, expected: true},
+		{name: "empty list is falsy", cond: `list`, expected: false},
+		{name: "parenthesized operands", cond: `and (.Values.enabled) (not .Values.debug)`, expected: true},
+		{name: "nested and or not", cond: `or (and .Values.debug .Values.enabled) (not (eq .Values.env "dev"))`, expected: true},
+		{name: "deeply nested", cond: `not (or (and (eq .Values.env "prod") (gt .Values.replicas 5)) (lt .Values.replicas 1))`, expected: true},
+		{name: "and with comparison operands", cond: `and (eq .Values.env "prod") (ge .Values.replicas 2) .Values.enabled`, expected: true},
+		{name: "or all falsy", cond: `or .Values.debug .Values.empty .Values.missing`, expected: false},
+		{name: "pipeline inside parentheses", cond: `eq (.Values.missing | default "fallback") "fallback"`, expected: true},
+		{name: "pipeline into comparison", cond: `.Values.tags | len | eq 2`, expected: true},
+		{name: "field of parenthesized result", cond: `eq (index .Values.list 0).name "first"`, expected: true},
+		{name: "function result as operand", cond: `has "b" .Values.tags`, expected: true},
+		{name: "semverCompare", cond: `semverCompare ">=1.2.0" .Values.image.tag`, expected: true},
+		{name: "and short-circuits before nil access", cond: `and .Values.missing .Values.missing.field`, expected: false},
+		{name: "or short-circuits", cond: `or .Values.enabled .Values.missing.field`, expected: true},
+		{name: "and function short-circuits", cond: `not (and .Values.missing .Values.missing.field)`, expected: true},
+		{name: "multiline condition", cond: "and\n  .Values.enabled\n  (eq .Values.env \"prod\")\n", expected: true},
+		{name: "incompatible comparison", cond: `lt .Values.env 3`, wantErr: true},
+		{name: "nil field access", cond: `.Values.missing.field`, wantErr: true},
+		{name: "infix and is not an operator", cond: `.Values.enabled and .Values.debug`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := map[string]interface{}{"list": []interface{}{map[string]interface{}{"name": "first"}}}
+			for k, val := range values {
+				v[k] = val
+			}
+			ctx := eval.NewEvalContext(v, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource("{{ if " + tt.cond + " }}yes{{ else }}no{{ end }}"))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			expected := "no"
+			if tt.expected {
+				expected = "yes"
+			}
+			if output != expected {
+				t.Errorf("expected %q, got %q", expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_TypedValues(t *testing.T) {
+	values := map[string]interface{}{
+		"replicas": 3,
+		"ratio":    0.25,
+		"enabled":  false,
+		"tags":     []interface{}{"a", "b"},
+		"image":    map[string]interface{}{"repo": "nginx", "tag": "1.21"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  string
+	}{
+		{name: "int keeps its type through functions", template: `{{ add .Values.replicas 1 }}`, expected: "4"},
+		{name: "float", template: `{{ mulf .Values.ratio 2 }}`, expected: "0.5"},
+		{name: "bool", template: `{{ .Values.enabled }}`, expected: "false"},
+		{name: "list", template: `{{ .Values.tags }}`, expected: "[a b]"},
+		{name: "list passed to a function", template: `{{ .Values.tags | join "," }}`, expected: "a,b"},
+		{name: "map passed to a function", template: `{{ .Values.image | toJson }}`, expected: `{"repo":"nginx","tag":"1.21"}`},
+		{name: "missing value prints nothing", template: `[{{ .Values.missing }}]`, expected: "[]"},
+		{name: "comment prints nothing", template: "a {{/* note */}}b", expected: "a b"},
+		{name: "comment with trim markers", template: "a {{- /* note */ -}} b", expected: "ab"},
+		{name: "string false is truthy", template: `{{ if "false" }}yes{{ end }}`, expected: "yes"},
+		{name: "zero is falsy", template: `{{ if 0 }}yes{{ else }}no{{ end }}`, expected: "no"},
+		{name: "unknown function", template: `{{ nosuchfunc 1 }}`, wantErr: "line 1:"},
+		{name: "error reports the line", template: "a\nb\n{{ .Values.missing.field }}", wantErr: "line 3: nil pointer evaluating interface {}.field"},
+		{name: "with reports errors", template: `{{ with .Values.missing.field }}x{{ end }}`, wantErr: "nil pointer evaluating"},
+		{name: "missing end", template: `{{ if .Values.enabled }}x`, wantErr: "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			var result []types.Token
+			if err == nil {
+				result, err = eval.EvaluateAST(nodes, ctx)
+			}
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if !contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateAST_Range(b *testing.B) {
+	items := make([]interface{}, 10000)
+	for i := range items {
+		items[i] = map[string]interface{}{"name": fmt.Sprintf("item%d", i), "port": i}
+	}
+	values := map[string]interface{}{"items": items, "prefix": "svc"}
+	nodes, err := ast.ParseAST(tokens.TokenizeSource(`{{- range $i, $item := .Values.items }}
+- name: {{ $.Values.prefix }}-{{ $item.name | upper }}
+  port: {{ add $item.port 8000 }}
+  {{- if eq (mod $i 2) 0 }}
+  even: true
+  {{- end }}
+{{- end }}`))
+	if err != nil {
+		b.Fatalf("unexpected error parsing AST: %v", err)
+	}
+	b.ResetTimer()
+	for b.Loop() {
+		ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+		if _, err := eval.EvaluateAST(nodes, ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEvaluateAST_RootObject(t *testing.T) {
+	values := map[string]interface{}{
+		"name":  "web",
+		"items": []interface{}{"a", "b"},
+		"maps":  []interface{}{map[string]interface{}{"id": 1}},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  string
+	}{
+		{name: "dot starts at the root", template: `{{ .Values.name }}-{{ .Chart.Name }}`, expected: "web-test"},
+		{name: "dollar is the root", template: `{{ $.Values.name }}`, expected: "web"},
+		{name: "root members", template: `{{ kindOf .Release }} {{ kindOf .Capabilities }} {{ kindOf .Files }} {{ kindOf .Template }}`, expected: "map map map map"},
+		{name: "dollar inside range", template: `{{ range .Values.items }}{{ $.Values.name }}-{{ . }} {{ end }}`, expected: "web-a web-b "},
+		{name: "dollar inside with", template: `{{ with .Values.name }}{{ . }}/{{ $.Chart.Name }}{{ end }}`, expected: "web/test"},
+		{name: "dot fields resolve against the range item", template: `{{ range .Values.maps }}{{ .id }}{{ end }}`, expected: "1"},
+		{name: "Values is not a member of a map item", template: `{{ range .Values.maps }}{{ .Values.name }}{{ end }}`, wantErr: "nil pointer evaluating interface {}.name"},
+		{name: "Values is not a field of a string item", template: `{{ range .Values.items }}{{ .Values.name }}{{ end }}`, wantErr: "can't evaluate field Values in type string"},
+		{name: "unknown root member is empty", template: `[{{ .Nope }}]`, expected: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			var result []types.Token
+			if err == nil {
+				result, err = eval.EvaluateAST(nodes, ctx)
+			}
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if !contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_Capabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities types.Capabilities
+		template     string
+		expected     string
+		wantErr      bool
+	}{
+		{
+			name:         "kube version parts",
+			capabilities: types.Capabilities{KubeVersion: "1.25"},
+			template:     `{{ .Capabilities.KubeVersion.Version }} {{ .Capabilities.KubeVersion.Major }} {{ .Capabilities.KubeVersion.Minor }}`,
+			expected:     "v1.25.0 1 25",
+		},
+		{
+			name:         "kube version keeps pre-release and build metadata",
+			capabilities: types.Capabilities{KubeVersion: "1.27.3-gke.100+abc"},
+			template:     `{{ .Capabilities.KubeVersion.Version }} {{ .Capabilities.KubeVersion.GitVersion }} {{ .Capabilities.KubeVersion.Minor }}`,
+			expected:     "v1.27.3-gke.100+abc v1.27.3-gke.100+abc 27",
+		},
+		{
+			name:         "suffixed kube version with semverCompare",
+			capabilities: types.Capabilities{KubeVersion: "v1.27.3-gke.100"},
+			template:     `{{ semverCompare ">=1.27-0" .Capabilities.KubeVersion.Version }}`,
+			expected:     "true",
+		},
+		{
+			name:         "kube version prints as its version",
+			capabilities: types.Capabilities{KubeVersion: "v1.28.3"},
+			template:     `{{ .Capabilities.KubeVersion }}`,
+			expected:     "v1.28.3",
+		},
+		{
+			name:         "git version with semverCompare",
+			capabilities: types.Capabilities{KubeVersion: "1.19"},
+			template:     `{{ if semverCompare ">=1.19-0" .Capabilities.KubeVersion.GitVersion }}networking.k8s.io/v1{{ else }}networking.k8s.io/v1beta1{{ end }}`,
+			expected:     "networking.k8s.io/v1",
+		},
+		{
+			name:         "api versions has",
+			capabilities: types.Capabilities{KubeVersion: "1.25", APIVersions: []string{"v1", "policy/v1"}},
+			template:     `{{ .Capabilities.APIVersions.Has "policy/v1" }} {{ .Capabilities.APIVersions.Has "policy/v1beta1" }}`,
+			expected:     "true false",
+		},
+		{
+			name:         "api versions has in a condition",
+			capabilities: types.Capabilities{KubeVersion: "1.25", APIVersions: []string{"v1"}},
+			template:     `{{ if .Capabilities.APIVersions.Has "policy/v1" }}policy/v1{{ else }}policy/v1beta1{{ end }}`,
+			expected:     "policy/v1beta1",
+		},
+		{
+			name:         "has through $ inside range",
+			capabilities: types.Capabilities{KubeVersion: "1.25", APIVersions: []string{"batch/v1"}},
+			template:     `{{ range list 1 }}{{ $.Capabilities.APIVersions.Has "batch/v1" }}{{ end }}`,
+			expected:     "true",
+		},
+		{
+			name:     "defaults",
+			template: `{{ .Capabilities.KubeVersion }} {{ .Capabilities.APIVersions.Has "apps/v1" }} {{ .Capabilities.HelmVersion.Version }}`,
+			expected: "v1.31.0 true v3.16.0",
+		},
+		{
+			name:         "method needs its arguments",
+			capabilities: types.Capabilities{KubeVersion: "1.25"},
+			template:     `{{ .Capabilities.APIVersions.Has }}`,
+			wantErr:      true,
+		},
+		{
+			name:         "arguments to a field",
+			capabilities: types.Capabilities{KubeVersion: "1.25"},
+			template:     `{{ .Capabilities.KubeVersion.Major "x" }}`,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capabilities, err := eval.NewCapabilities(tt.capabilities)
+			if err != nil {
+				t.Fatalf("NewCapabilities: %v", err)
+			}
+			ctx := eval.NewEvalContext(map[string]interface{}{}, map[string]interface{}{"Name": "test"})
+			ctx.Root.(map[string]interface{})["Capabilities"] = capabilities
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestEvaluateAST_Files(t *testing.T) {
+	files := eval.Files{
+		"config/app.conf":    []byte("port=80\nhost=local\n"),
+		"config/db.conf":     []byte("url=db"),
+		"config/nested/x.md": []byte("doc"),
+		"README.md":          []byte("readme"),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{name: "get", template: `{{ .Files.Get "config/db.conf" }}`, expected: "url=db"},
+		{name: "get missing file", template: `[{{ .Files.Get "nope" }}]`, expected: "[]"},
+		{name: "get bytes", template: `{{ .Files.GetBytes "config/db.conf" | len }}`, expected: "6"},
+		{name: "get piped into functions", template: `{{ .Files.Get "config/db.conf" | b64enc }}`, expected: "dXJsPWRi"},
+		{name: "lines", template: `{{ range .Files.Lines "config/app.conf" }}[{{ . }}]{{ end }}`, expected: "[port=80][host=local]"},
+		{name: "glob star stays in a directory", template: `{{ range $path, $_ := .Files.Glob "config/*" }}{{ $path }} {{ end }}`, expected: "config/app.conf config/db.conf "},
+		{name: "glob double star", template: `{{ range $path, $_ := .Files.Glob "**.md" }}{{ $path }} {{ end }}`, expected: "README.md config/nested/x.md "},
+		{name: "glob braces", template: `{{ len (.Files.Glob "{README.md,config/db.conf}") }}`, expected: "2"},
+		{name: "glob as config", template: `{{ (.Files.Glob "config/*.conf").AsConfig }}`, expected: "app.conf: |\n  port=80\n  host=local\ndb.conf: url=db"},
+		{name: "glob as secrets", template: `{{ (.Files.Glob "config/db.conf").AsSecrets }}`, expected: "db.conf: dXJsPWRi"},
+		{name: "get with dollar inside range", template: `{{ range list "config/db.conf" }}{{ $.Files.Get . }}{{ end }}`, expected: "url=db"},
+		{name: "invalid glob", template: `{{ .Files.Glob "[a" }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := eval.NewEvalContext(map[string]interface{}{}, map[string]interface{}{"Name": "test"})
+			ctx.Root.(map[string]interface{})["Files"] = files
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(tt.template))
+			if err != nil {
+				t.Fatalf("unexpected error parsing AST: %v", err)
+			}
+			result, err := eval.EvaluateAST(nodes, ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output := ""
+			for _, tok := range result {
+				output += tok.Value
+			}
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package eval
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Files is the .Files object of the template root. It maps the slash
+// separated paths of the chart's non-template files to their content.
+type Files map[string][]byte
+
+// Get returns the content of a file as a string, or an empty string if the
+// file does not exist
+func (f Files) Get(name string) string {
+	return string(f.GetBytes(name))
+}
+
+// GetBytes returns the content of a file, or nil if it does not exist
+func (f Files) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Glob returns the files whose paths match the pattern. Like Helm, * does
+// not cross directories while ** does, and {a,b} matches either
+// alternative.
+func (f Files) Glob(pattern string) (Files, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(Files)
+	for name, content := range f {
+		if re.MatchString(name) {
+			matched[name] = content
+		}
+	}
+	return matched, nil
+}
+
+// Lines returns the lines of a file, without a trailing empty line
+func (f Files) Lines(name string) []string {
+	content := f.Get(name)
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// AsConfig returns the files as a YAML mapping of base names to contents,
+// suitable for the data of a ConfigMap
+func (f Files) AsConfig() string {
+	if len(f) == 0 {
+		return ""
+	}
+	m := make(map[string]string, len(f))
+	for name, content := range f {
+		m[path.Base(name)] = string(content)
+	}
+	return toYAML(m)
+}
+
+// AsSecrets returns the files as a YAML mapping of base names to base64
+// encoded contents, suitable for the data of a Secret
+func (f Files) AsSecrets() string {
+	if len(f) == 0 {
+		return ""
+	}
+	m := make(map[string]string, len(f))
+	for name, content := range f {
+		m[path.Base(name)] = base64.StdEncoding.EncodeToString(content)
+	}
+	return toYAML(m)
+}
+
+// globRegexp translates a glob pattern into an anchored regular expression
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	inBraces := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob pattern %q: unclosed [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '{' && !inBraces:
+			sb.WriteString("(?:")
+			inBraces = true
+		case c == '}' && inBraces:
+			sb.WriteString(")")
+			inBraces = false
+		case c == ',' && inBraces:
+			sb.WriteString("|")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if inBraces {
+		return nil, fmt.Errorf("invalid glob pattern %q: unclosed {", pattern)
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,210 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"helmish/internal/renderer/types"
+)
+
+// FuncMap returns the Sprig-compatible functions registered on every
+// EvalContext created by NewEvalContext
+func FuncMap() types.FuncMap {
+	funcs := types.FuncMap{}
+	groups := []types.FuncMap{
+		defaultFuncs(),
+		stringFuncs(),
+		listFuncs(),
+		dictFuncs(),
+		mathFuncs(),
+		encodingFuncs(),
+		semverFuncs(),
+	}
+	for _, group := range groups {
+		for name, fn := range group {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// defaultFuncs holds the Sprig default and type functions, along with
+// fail and Helm's required
+func defaultFuncs() types.FuncMap {
+	return types.FuncMap{
+		"required":  required,
+		"fail":      func(msg string) (string, error) { return "", errors.New(msg) },
+		"default":   dfault,
+		"empty":     empty,
+		"coalesce":  coalesce,
+		"ternary":   ternary,
+		"typeOf":    func(v interface{}) string { return fmt.Sprintf("%T", v) },
+		"typeIs":    func(target string, v interface{}) bool { return target == fmt.Sprintf("%T", v) },
+		"kindOf":    kindOf,
+		"kindIs":    func(target string, v interface{}) bool { return target == kindOf(v) },
+		"deepEqual": reflect.DeepEqual,
+	}
+}
+
+// dfault returns the given value, or d if the value is empty
+func dfault(d interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || empty(given[0]) {
+		return d
+	}
+	return given[0]
+}
+
+// empty reports whether a value is the zero value of its type
+func empty(given interface{}) bool {
+	g := reflect.ValueOf(given)
+	if !g.IsValid() {
+		return true
+	}
+	switch g.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return g.Len() == 0
+	case reflect.Bool:
+		return !g.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return g.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return g.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return g.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return g.Complex() == 0
+	case reflect.Struct:
+		return false
+	default:
+		return g.IsNil()
+	}
+}
+
+// required returns the value, or fails with the message if the value is
+// nil or an empty string, like Helm's required
+func required(msg string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, errors.New(msg)
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// coalesce returns the first non-empty argument
+func coalesce(v ...interface{}) interface{} {
+	for _, val := range v {
+		if !empty(val) {
+			return val
+		}
+	}
+	return nil
+}
+
+// ternary returns vt if v is true and vf otherwise
+func ternary(vt interface{}, vf interface{}, v bool) interface{} {
+	if v {
+		return vt
+	}
+	return vf
+}
+
+func kindOf(v interface{}) string {
+	if v == nil {
+		return "invalid"
+	}
+	return reflect.ValueOf(v).Kind().String()
+}
+
+// strval converts any value to its string representation
+func strval(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toInt64 converts numbers, numeric strings and booleans to an int64,
+// returning 0 for anything else
+func toInt64(v interface{}) int64 {
+	if s, ok := v.(string); ok {
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int64(f)
+		}
+		return 0
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(val.Float())
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// toFloat64 converts numbers, numeric strings and booleans to a float64,
+// returning 0 for anything else
+func toFloat64(v interface{}) float64 {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0
+		}
+		return f
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// toList converts any slice or array to a []interface{}
+func toList(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if l, ok := v.([]interface{}); ok {
+		return l, nil
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		l := make([]interface{}, val.Len())
+		for i := range l {
+			l[i] = val.Index(i).Interface()
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("cannot use type %T as a list", v)
+}
@@ -0,0 +1,216 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+
+	"helmish/internal/renderer/types"
+)
+
+// dictFuncs holds the Sprig dictionary functions
+func dictFuncs() types.FuncMap {
+	return types.FuncMap{
+		"dict":           dict,
+		"get":            get,
+		"set":            set,
+		"unset":          unset,
+		"hasKey":         hasKey,
+		"pluck":          pluck,
+		"keys":           keys,
+		"values":         values,
+		"pick":           pick,
+		"omit":           omit,
+		"merge":          merge,
+		"mergeOverwrite": mergeOverwrite,
+		"deepCopy":       deepCopy,
+		"dig":            dig,
+		// merge cannot fail, so its must variants are the same functions
+		"mustMerge":          merge,
+		"mustMergeOverwrite": mergeOverwrite,
+		"mustDeepCopy":       mustDeepCopy,
+	}
+}
+
+// dict builds a dictionary from alternating keys and values
+func dict(v ...interface{}) map[string]interface{} {
+	d := make(map[string]interface{}, len(v)/2)
+	for i := 0; i < len(v); i += 2 {
+		key := strval(v[i])
+		if i+1 >= len(v) {
+			d[key] = ""
+			continue
+		}
+		d[key] = v[i+1]
+	}
+	return d
+}
+
+// get returns the value for key, or an empty string when it is missing
+func get(d map[string]interface{}, key string) interface{} {
+	if val, ok := d[key]; ok {
+		return val
+	}
+	return ""
+}
+
+func set(d map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	d[key] = value
+	return d
+}
+
+func unset(d map[string]interface{}, key string) map[string]interface{} {
+	delete(d, key)
+	return d
+}
+
+func hasKey(d map[string]interface{}, key string) bool {
+	_, ok := d[key]
+	return ok
+}
+
+// pluck returns the value for key from every dictionary that has it
+func pluck(key string, d ...map[string]interface{}) []interface{} {
+	var res []interface{}
+	for _, dict := range d {
+		if val, ok := dict[key]; ok {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
+// keys returns the sorted keys of all the given dictionaries
+func keys(dicts ...map[string]interface{}) []interface{} {
+	var names []string
+	for _, d := range dicts {
+		for k := range d {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	res := make([]interface{}, len(names))
+	for i, k := range names {
+		res[i] = k
+	}
+	return res
+}
+
+// values returns the values of a dictionary, ordered by key
+func values(d map[string]interface{}) []interface{} {
+	res := make([]interface{}, 0, len(d))
+	for _, k := range keys(d) {
+		res = append(res, d[k.(string)])
+	}
+	return res
+}
+
+// pick returns a new dictionary holding only the given keys
+func pick(d map[string]interface{}, keys ...string) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, k := range keys {
+		if v, ok := d[k]; ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// omit returns a new dictionary without the given keys
+func omit(d map[string]interface{}, keys ...string) map[string]interface{} {
+	skip := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		skip[k] = true
+	}
+	res := map[string]interface{}{}
+	for k, v := range d {
+		if !skip[k] {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// merge deep-merges the source dictionaries into dst; keys already set in
+// dst take precedence
+func merge(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+	for _, src := range srcs {
+		mergeInto(dst, src, false)
+	}
+	return dst
+}
+
+// mergeOverwrite deep-merges the source dictionaries into dst; later
+// sources take precedence
+func mergeOverwrite(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+	for _, src := range srcs {
+		mergeInto(dst, src, true)
+	}
+	return dst
+}
+
+func mergeInto(dst, src map[string]interface{}, overwrite bool) {
+	for k, sv := range src {
+		dv, exists := dst[k]
+		dm, dok := dv.(map[string]interface{})
+		sm, sok := sv.(map[string]interface{})
+		switch {
+		case dok && sok:
+			mergeInto(dm, sm, overwrite)
+		case !exists || empty(dv) || (overwrite && !empty(sv)):
+			dst[k] = deepCopy(sv)
+		}
+	}
+}
+
+// deepCopy returns a copy of a value, recursively copying maps and lists
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[k] = deepCopy(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, val := range v {
+			res[i] = deepCopy(val)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// mustDeepCopy is deepCopy that fails on nil
+func mustDeepCopy(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("must pass in a non-nil value")
+	}
+	return deepCopy(v), nil
+}
+
+// dig walks nested dictionaries by key: dig "a" "b" default dict
+func dig(ps ...interface{}) (interface{}, error) {
+	if len(ps) < 3 {
+		return nil, fmt.Errorf("dig needs at least three arguments")
+	}
+	d, ok := ps[len(ps)-1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("last argument to dig must be a dict, got %T", ps[len(ps)-1])
+	}
+	def := ps[len(ps)-2]
+	path := ps[:len(ps)-2]
+	var current interface{} = d
+	for _, p := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return def, nil
+		}
+		current, ok = m[strval(p)]
+		if !ok {
+			return def, nil
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,36 @@
+package eval_test
+
+import "testing"
+
+func TestDictFuncs(t *testing.T) {
+	newValues := func() map[string]interface{} {
+		return map[string]interface{}{
+			"labels":   map[string]interface{}{"app": "web", "tier": "frontend"},
+			"defaults": map[string]interface{}{"app": "default", "team": "core", "nested": map[string]interface{}{"a": 1, "b": 2}},
+			"override": map[string]interface{}{"app": "override", "nested": map[string]interface{}{"b": 3}},
+		}
+	}
+	runFuncTests(t, []funcTest{
+		{name: "dict", tmpl: `{{ dict "a" 1 "b" "two" }}`, expected: "map[a:1 b:two]"},
+		{name: "dict odd arguments", tmpl: `{{ dict "a" 1 "b" }}`, expected: "map[a:1 b:]"},
+		{name: "get", tmpl: `{{ get .Values.labels "app" }}`, values: newValues(), expected: "web"},
+		{name: "get missing", tmpl: `{{ get .Values.labels "nope" | quote }}`, values: newValues(), expected: `""`},
+		{name: "set", tmpl: `{{ set .Values.labels "env" "prod" }}`, values: newValues(), expected: "map[app:web env:prod tier:frontend]"},
+		{name: "unset", tmpl: `{{ unset .Values.labels "tier" }}`, values: newValues(), expected: "map[app:web]"},
+		{name: "hasKey", tmpl: `{{ hasKey .Values.labels "app" }}`, values: newValues(), expected: "true"},
+		{name: "hasKey missing", tmpl: `{{ hasKey .Values.labels "env" }}`, values: newValues(), expected: "false"},
+		{name: "pluck", tmpl: `{{ pluck "app" .Values.labels .Values.defaults }}`, values: newValues(), expected: "[web default]"},
+		{name: "keys sorted", tmpl: `{{ keys .Values.labels }}`, values: newValues(), expected: "[app tier]"},
+		{name: "values", tmpl: `{{ values .Values.labels }}`, values: newValues(), expected: "[web frontend]"},
+		{name: "pick", tmpl: `{{ pick .Values.defaults "team" }}`, values: newValues(), expected: "map[team:core]"},
+		{name: "omit", tmpl: `{{ omit .Values.labels "tier" }}`, values: newValues(), expected: "map[app:web]"},
+		{name: "merge keeps destination", tmpl: `{{ merge .Values.override .Values.defaults }}`, values: newValues(), expected: "map[app:override nested:map[a:1 b:3] team:core]"},
+		{name: "mergeOverwrite", tmpl: `{{ mergeOverwrite .Values.defaults .Values.override }}`, values: newValues(), expected: "map[app:override nested:map[a:1 b:3] team:core]"},
+		{name: "dig", tmpl: `{{ dig "nested" "b" "none" .Values.defaults }}`, values: newValues(), expected: "2"},
+		{name: "dig default", tmpl: `{{ dig "nested" "z" "none" .Values.defaults }}`, values: newValues(), expected: "none"},
+		{name: "mustMerge", tmpl: `{{ mustMerge .Values.override .Values.defaults }}`, values: newValues(), expected: "map[app:override nested:map[a:1 b:3] team:core]"},
+		{name: "mustDeepCopy", tmpl: `{{ mustDeepCopy .Values.labels }}`, values: newValues(), expected: "map[app:web tier:frontend]"},
+		{name: "mustDeepCopy nil", tmpl: `{{ mustDeepCopy .Values.missing }}`, values: newValues(), wantErr: true},
+		{name: "hasKey on non-dict", tmpl: `{{ hasKey "abc" "a" }}`, wantErr: true},
+	})
+}
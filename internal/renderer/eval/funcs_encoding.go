@@ -0,0 +1,266 @@
+package eval
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/adler32"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"helmish/internal/renderer/types"
+)
+
+// encodingFuncs holds the Sprig encoding and hashing functions together
+// with the JSON and YAML conversions Helm adds on top of Sprig
+func encodingFuncs() types.FuncMap {
+	return types.FuncMap{
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) (string, error) {
+			data, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		},
+		"b32enc": func(s string) string { return base32.StdEncoding.EncodeToString([]byte(s)) },
+		"b32dec": func(s string) (string, error) {
+			data, err := base32.StdEncoding.DecodeString(s)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		},
+		"sha1sum": func(s string) string {
+			sum := sha1.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha256sum": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha512sum": func(s string) string {
+			sum := sha512.Sum512([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"adler32sum": func(s string) string {
+			return fmt.Sprintf("%d", adler32.Checksum([]byte(s)))
+		},
+		"toJson":           toJSON,
+		"toPrettyJson":     toPrettyJSON,
+		"toRawJson":        toRawJSON,
+		"mustToJson":       mustToJSON,
+		"mustToPrettyJson": mustToPrettyJSON,
+		"mustToRawJson":    mustToRawJSON,
+		"fromJson":         fromJSON,
+		"toYaml":           toYAML,
+		"fromYaml":         fromYAML,
+	}
+}
+
+// toJSON encodes a value as JSON, returning an empty string on failure
+func toJSON(v interface{}) string {
+	s, _ := mustToJSON(v)
+	return s
+}
+
+// mustToJSON encodes a value as JSON
+func mustToJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(jsonable(v))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toPrettyJSON encodes a value as indented JSON, returning an empty string
+// on failure
+func toPrettyJSON(v interface{}) string {
+	s, _ := mustToPrettyJSON(v)
+	return s
+}
+
+// mustToPrettyJSON encodes a value as indented JSON
+func mustToPrettyJSON(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(jsonable(v), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toRawJSON encodes a value as JSON without escaping HTML characters,
+// returning an empty string on failure
+func toRawJSON(v interface{}) string {
+	s, _ := mustToRawJSON(v)
+	return s
+}
+
+// mustToRawJSON encodes a value as JSON without escaping HTML characters
+func mustToRawJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(jsonable(v)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// fromJSON decodes a JSON object. Like Helm, errors are reported under the
+// "Error" key of the result.
+func fromJSON(s string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+// toYAML encodes a value as YAML with two space indentation, without the
+// trailing newline. Like the YAML library Helm uses, the items of a sequence
+// in a mapping are not indented, so toYaml | nindent renders as in Helm.
+func toYAML(v interface{}) string {
+	var node yaml.Node
+	if err := node.Encode(v); err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	if err := writeYAML(&sb, &node, 0, false); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// writeYAML writes a node in block style at the given indentation. inline
+// means the first line continues a "- " already written at that column.
+func writeYAML(sb *strings.Builder, n *yaml.Node, indent int, inline bool) error {
+	pad := func(first bool) {
+		if !first || !inline {
+			sb.WriteString(strings.Repeat(" ", indent))
+		}
+	}
+	switch {
+	case n.Kind == yaml.MappingNode && len(n.Content) > 0:
+		for i := 0; i < len(n.Content); i += 2 {
+			pad(i == 0)
+			key, err := yamlScalar(n.Content[i], indent)
+			if err != nil {
+				return err
+			}
+			sb.WriteString(key + ":")
+			val := n.Content[i+1]
+			switch {
+			case isBlockNode(val, yaml.MappingNode):
+				sb.WriteString("\n")
+				err = writeYAML(sb, val, indent+2, false)
+			case isBlockNode(val, yaml.SequenceNode):
+				sb.WriteString("\n")
+				err = writeYAML(sb, val, indent, false)
+			default:
+				var scalar string
+				scalar, err = yamlScalar(val, indent)
+				sb.WriteString(" " + scalar + "\n")
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case n.Kind == yaml.SequenceNode && len(n.Content) > 0:
+		for i, item := range n.Content {
+			pad(i == 0)
+			sb.WriteString("- ")
+			if isBlockNode(item, yaml.MappingNode) || isBlockNode(item, yaml.SequenceNode) {
+				if err := writeYAML(sb, item, indent+2, true); err != nil {
+					return err
+				}
+				continue
+			}
+			scalar, err := yamlScalar(item, indent)
+			if err != nil {
+				return err
+			}
+			sb.WriteString(scalar + "\n")
+		}
+	default:
+		pad(true)
+		scalar, err := yamlScalar(n, indent)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(scalar + "\n")
+	}
+	return nil
+}
+
+// isBlockNode reports whether n is a non-empty node of the given kind, which
+// is written in block style
+func isBlockNode(n *yaml.Node, kind yaml.Kind) bool {
+	return n.Kind == kind && len(n.Content) > 0
+}
+
+// yamlScalar encodes a scalar, or an empty mapping or sequence, with
+// yaml.v3. The continuation lines of block scalars are indented past the
+// given indentation.
+func yamlScalar(n *yaml.Node, indent int) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", indent) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// fromYAML decodes a YAML mapping. Like Helm, errors are reported under the
+// "Error" key of the result.
+func fromYAML(s string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+// jsonable converts maps with interface{} keys, which encoding/json cannot
+// handle, into maps with string keys
+func jsonable(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[strval(k)] = jsonable(val)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[k] = jsonable(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, val := range v {
+			res[i] = jsonable(val)
+		}
+		return res
+	default:
+		return v
+	}
+}
@@ -0,0 +1,41 @@
+package eval_test
+
+import "testing"
+
+func TestEncodingFuncs(t *testing.T) {
+	values := map[string]interface{}{
+		"config": map[string]interface{}{"b": []interface{}{1, 2}, "a": "x"},
+		"ports":  []interface{}{80},
+		"nested": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "web", "ports": []interface{}{80, 443}},
+				[]interface{}{"a", "b"},
+			},
+			"empty": []interface{}{},
+			"none":  map[string]interface{}{},
+		},
+		"script": map[string]interface{}{"run": "echo a\necho b", "steps": []interface{}{"one\ntwo"}},
+	}
+	runFuncTests(t, []funcTest{
+		{name: "b64enc", tmpl: `{{ "hello" | b64enc }}`, expected: "aGVsbG8="},
+		{name: "b64dec", tmpl: `{{ "aGVsbG8=" | b64dec }}`, expected: "hello"},
+		{name: "b64dec invalid", tmpl: `{{ "!!!" | b64dec }}`, wantErr: true},
+		{name: "b32enc", tmpl: `{{ "hello" | b32enc }}`, expected: "NBSWY3DP"},
+		{name: "b32dec", tmpl: `{{ "NBSWY3DP" | b32dec }}`, expected: "hello"},
+		{name: "sha256sum", tmpl: `{{ "hello" | sha256sum }}`, expected: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{name: "sha512sum", tmpl: `{{ "hello" | sha512sum }}`, expected: "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+		{name: "sha1sum", tmpl: `{{ "hello" | sha1sum }}`, expected: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{name: "toJson", tmpl: `{{ .Values.config | toJson }}`, values: values, expected: `{"a":"x","b":[1,2]}`},
+		{name: "toPrettyJson", tmpl: `{{ .Values.ports | toPrettyJson }}`, values: values, expected: "[\n  80\n]"},
+		{name: "mustToJson", tmpl: `{{ .Values.ports | mustToJson }}`, values: values, expected: "[80]"},
+		{name: "mustToJson unsupported value", tmpl: `{{ mustToJson .Values.ch }}`, values: map[string]interface{}{"ch": make(chan int)}, wantErr: true},
+		{name: "toRawJson keeps html", tmpl: `{{ toRawJson "<a>" }}`, expected: `"<a>"`},
+		{name: "toYaml", tmpl: `{{ .Values.config | toYaml }}`, values: values, expected: "a: x\nb:\n- 1\n- 2"},
+		{name: "toYaml nindent", tmpl: `{{ .Values.config | toYaml | nindent 2 }}`, values: values, expected: "\n  a: x\n  b:\n  - 1\n  - 2"},
+		{name: "toYaml nested lists", tmpl: `{{ .Values.nested | toYaml }}`, values: values, expected: "containers:\n- name: web\n  ports:\n  - 80\n  - 443\n- - a\n  - b\nempty: []\nnone: {}"},
+		{name: "toYaml multiline strings", tmpl: `{{ .Values.script | toYaml }}`, values: values, expected: "run: |-\n  echo a\n  echo b\nsteps:\n- |-\n  one\n  two"},
+		{name: "toYaml scalar", tmpl: `{{ toYaml "a: b" }}`, expected: "'a: b'"},
+		{name: "fromJson", tmpl: `{{ fromJson "{\"a\": 1}" }}`, expected: "map[a:1]"},
+		{name: "fromYaml", tmpl: `{{ fromYaml "a: b" }}`, expected: "map[a:b]"},
+	})
+}
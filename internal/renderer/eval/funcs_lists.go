@@ -0,0 +1,291 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"helmish/internal/renderer/types"
+)
+
+// listFuncs holds the Sprig list functions
+func listFuncs() types.FuncMap {
+	return types.FuncMap{
+		"list":      func(v ...interface{}) []interface{} { return v },
+		"first":     first,
+		"last":      last,
+		"rest":      rest,
+		"initial":   initial,
+		"append":    push,
+		"push":      push,
+		"prepend":   prepend,
+		"concat":    concat,
+		"reverse":   reverse,
+		"uniq":      uniq,
+		"without":   without,
+		"has":       has,
+		"compact":   compact,
+		"slice":     slice,
+		"until":     func(count int) []interface{} { return untilStep(0, count, 1) },
+		"untilStep": untilStep,
+		"sortAlpha": sortAlpha,
+		"seq":       seq,
+		"chunk":     chunk,
+		// The list functions report errors rather than panic, so the must
+		// variants are the same functions
+		"mustFirst":   first,
+		"mustLast":    last,
+		"mustRest":    rest,
+		"mustInitial": initial,
+		"mustAppend":  push,
+		"mustPush":    push,
+		"mustPrepend": prepend,
+		"mustReverse": reverse,
+		"mustUniq":    uniq,
+		"mustWithout": without,
+		"mustHas":     has,
+		"mustCompact": compact,
+		"mustSlice":   slice,
+		"mustChunk":   chunk,
+	}
+}
+
+func first(list interface{}) (interface{}, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[0], nil
+}
+
+func last(list interface{}) (interface{}, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[len(l)-1], nil
+}
+
+// rest returns everything but the first element
+func rest(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return append([]interface{}{}, l[1:]...), nil
+}
+
+// initial returns everything but the last element
+func initial(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return append([]interface{}{}, l[:len(l)-1]...), nil
+}
+
+// push returns a copy of the list with v appended
+func push(list interface{}, v interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]interface{}{}, l...), v), nil
+}
+
+// prepend returns a copy of the list with v at the front
+func prepend(list interface{}, v interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	return append([]interface{}{v}, l...), nil
+}
+
+func concat(lists ...interface{}) ([]interface{}, error) {
+	var res []interface{}
+	for _, list := range lists {
+		l, err := toList(list)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, l...)
+	}
+	return res, nil
+}
+
+func reverse(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(l))
+	for i, v := range l {
+		res[len(l)-1-i] = v
+	}
+	return res, nil
+}
+
+// uniq returns the list without duplicate elements, keeping the first of each
+func uniq(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var res []interface{}
+	for _, v := range l {
+		if !inList(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// without returns the list with all the given elements removed
+func without(list interface{}, omit ...interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var res []interface{}
+	for _, v := range l {
+		if !inList(omit, v) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// has reports whether the haystack list contains the needle
+func has(needle interface{}, haystack interface{}) (bool, error) {
+	l, err := toList(haystack)
+	if err != nil {
+		return false, err
+	}
+	return inList(l, needle), nil
+}
+
+// compact returns the list without empty elements
+func compact(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var res []interface{}
+	for _, v := range l {
+		if !empty(v) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// slice returns list[start:end]; both indices are optional
+func slice(list interface{}, indices ...interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	start, end := 0, len(l)
+	if len(indices) > 0 {
+		start = int(toInt64(indices[0]))
+	}
+	if len(indices) > 1 {
+		end = int(toInt64(indices[1]))
+	}
+	if start < 0 || end > len(l) || start > end {
+		return nil, fmt.Errorf("slice bounds out of range [%d:%d] with length %d", start, end, len(l))
+	}
+	return append([]interface{}{}, l[start:end]...), nil
+}
+
+// untilStep returns the integers from start up to, but not including, stop
+func untilStep(start, stop, step int) []interface{} {
+	var res []interface{}
+	if step == 0 {
+		return res
+	}
+	if step > 0 {
+		for i := start; i < stop; i += step {
+			res = append(res, i)
+		}
+	} else {
+		for i := start; i > stop; i += step {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// seq returns the integers of a sequence separated by spaces, like the seq
+// command: seq end, seq start end, or seq start step end. The sequence
+// counts down when end is below start.
+func seq(params ...int) string {
+	var start, step, end int
+	switch len(params) {
+	case 1:
+		start, step, end = 1, 1, params[0]
+	case 2:
+		start, step, end = params[0], 1, params[1]
+	case 3:
+		start, step, end = params[0], params[1], params[2]
+	default:
+		return ""
+	}
+	stop := end + 1
+	if end < start {
+		if len(params) == 3 && step > 0 {
+			return ""
+		}
+		if len(params) < 3 {
+			step = -1
+		}
+		stop = end - 1
+	}
+	nums := untilStep(start, stop, step)
+	out := make([]string, len(nums))
+	for i, n := range nums {
+		out[i] = strval(n)
+	}
+	return strings.Join(out, " ")
+}
+
+// chunk splits a list into lists of the given size; the last one holds
+// what is left
+func chunk(size int, list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	var res []interface{}
+	for len(l) > 0 {
+		n := min(size, len(l))
+		res = append(res, append([]interface{}{}, l[:n]...))
+		l = l[n:]
+	}
+	return res, nil
+}
+
+// sortAlpha sorts a list by the string representation of its elements
+func sortAlpha(list interface{}) ([]interface{}, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	res := append([]interface{}{}, l...)
+	sort.SliceStable(res, func(i, j int) bool { return strval(res[i]) < strval(res[j]) })
+	return res, nil
+}
+
+func inList(list []interface{}, needle interface{}) bool {
+	for _, v := range list {
+		if reflect.DeepEqual(v, needle) {
+			return true
+		}
+	}
+	return false
+}
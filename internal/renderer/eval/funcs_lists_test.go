@@ -0,0 +1,45 @@
+package eval_test
+
+import "testing"
+
+func TestListFuncs(t *testing.T) {
+	values := map[string]interface{}{
+		"items": []interface{}{"b", "a", "c", "a"},
+		"nums":  []interface{}{1, 2, 3},
+		"mixed": []interface{}{"x", "", nil, 0, "y"},
+	}
+	runFuncTests(t, []funcTest{
+		{name: "list", tmpl: `{{ list 1 "two" true }}`, expected: "[1 two true]"},
+		{name: "list len", tmpl: `{{ list 1 2 3 | len }}`, expected: "3"},
+		{name: "first", tmpl: `{{ first .Values.items }}`, values: values, expected: "b"},
+		{name: "last", tmpl: `{{ last .Values.items }}`, values: values, expected: "a"},
+		{name: "rest", tmpl: `{{ rest .Values.nums }}`, values: values, expected: "[2 3]"},
+		{name: "initial", tmpl: `{{ initial .Values.nums }}`, values: values, expected: "[1 2]"},
+		{name: "append", tmpl: `{{ append .Values.nums 4 }}`, values: values, expected: "[1 2 3 4]"},
+		{name: "prepend", tmpl: `{{ prepend .Values.nums 0 }}`, values: values, expected: "[0 1 2 3]"},
+		{name: "concat", tmpl: `{{ concat .Values.nums .Values.nums }}`, values: values, expected: "[1 2 3 1 2 3]"},
+		{name: "reverse", tmpl: `{{ reverse .Values.nums }}`, values: values, expected: "[3 2 1]"},
+		{name: "uniq", tmpl: `{{ uniq .Values.items }}`, values: values, expected: "[b a c]"},
+		{name: "without", tmpl: `{{ without .Values.items "a" }}`, values: values, expected: "[b c]"},
+		{name: "has", tmpl: `{{ has "c" .Values.items }}`, values: values, expected: "true"},
+		{name: "has missing", tmpl: `{{ has 4 .Values.nums }}`, values: values, expected: "false"},
+		{name: "compact", tmpl: `{{ compact .Values.mixed }}`, values: values, expected: "[x y]"},
+		{name: "slice", tmpl: `{{ slice .Values.items 1 3 }}`, values: values, expected: "[a c]"},
+		{name: "slice out of range", tmpl: `{{ slice .Values.items 1 9 }}`, values: values, wantErr: true},
+		{name: "until", tmpl: `{{ until 3 }}`, expected: "[0 1 2]"},
+		{name: "untilStep", tmpl: `{{ untilStep 3 9 2 }}`, expected: "[3 5 7]"},
+		{name: "sortAlpha", tmpl: `{{ sortAlpha .Values.items }}`, values: values, expected: "[a a b c]"},
+		{name: "first of non-list", tmpl: `{{ first 3 }}`, wantErr: true},
+		{name: "mustFirst", tmpl: `{{ mustFirst .Values.items }}`, values: values, expected: "b"},
+		{name: "mustAppend of non-list", tmpl: `{{ mustAppend 3 4 }}`, wantErr: true},
+		{name: "seq end", tmpl: `{{ seq 3 }}`, expected: "1 2 3"},
+		{name: "seq start end", tmpl: `{{ seq 2 5 }}`, expected: "2 3 4 5"},
+		{name: "seq counts down", tmpl: `{{ seq 3 1 }}`, expected: "3 2 1"},
+		{name: "seq step", tmpl: `{{ seq 0 5 12 }}`, expected: "0 5 10"},
+		{name: "seq negative step", tmpl: `{{ seq 10 -3 1 }}`, expected: "10 7 4 1"},
+		{name: "seq wrong direction", tmpl: `{{ seq 5 1 1 }}`, expected: ""},
+		{name: "chunk", tmpl: `{{ chunk 2 .Values.nums }}`, values: values, expected: "[[1 2] [3]]"},
+		{name: "chunk exact", tmpl: `{{ chunk 3 .Values.nums }}`, values: values, expected: "[[1 2 3]]"},
+		{name: "mustChunk invalid size", tmpl: `{{ mustChunk 0 .Values.nums }}`, values: values, wantErr: true},
+	})
+}
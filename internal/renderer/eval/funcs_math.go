@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"helmish/internal/renderer/types"
+)
+
+// mathFuncs holds the Sprig integer and float math functions
+func mathFuncs() types.FuncMap {
+	return types.FuncMap{
+		"add": func(i ...interface{}) int64 {
+			var a int64
+			for _, b := range i {
+				a += toInt64(b)
+			}
+			return a
+		},
+		"add1": func(i interface{}) int64 { return toInt64(i) + 1 },
+		"sub":  func(a, b interface{}) int64 { return toInt64(a) - toInt64(b) },
+		"mul": func(a interface{}, v ...interface{}) int64 {
+			val := toInt64(a)
+			for _, b := range v {
+				val *= toInt64(b)
+			}
+			return val
+		},
+		"div": func(a, b interface{}) (int64, error) {
+			if toInt64(b) == 0 {
+				return 0, fmt.Errorf("integer divide by zero")
+			}
+			return toInt64(a) / toInt64(b), nil
+		},
+		"mod": func(a, b interface{}) (int64, error) {
+			if toInt64(b) == 0 {
+				return 0, fmt.Errorf("integer divide by zero")
+			}
+			return toInt64(a) % toInt64(b), nil
+		},
+		"max": func(a interface{}, i ...interface{}) int64 {
+			aa := toInt64(a)
+			for _, b := range i {
+				if bb := toInt64(b); bb > aa {
+					aa = bb
+				}
+			}
+			return aa
+		},
+		"min": func(a interface{}, i ...interface{}) int64 {
+			aa := toInt64(a)
+			for _, b := range i {
+				if bb := toInt64(b); bb < aa {
+					aa = bb
+				}
+			}
+			return aa
+		},
+		"addf": func(i ...interface{}) float64 {
+			var a float64
+			for _, b := range i {
+				a += toFloat64(b)
+			}
+			return a
+		},
+		"add1f": func(i interface{}) float64 { return toFloat64(i) + 1 },
+		"subf": func(a interface{}, v ...interface{}) float64 {
+			val := toFloat64(a)
+			for _, b := range v {
+				val -= toFloat64(b)
+			}
+			return val
+		},
+		"mulf": func(a interface{}, v ...interface{}) float64 {
+			val := toFloat64(a)
+			for _, b := range v {
+				val *= toFloat64(b)
+			}
+			return val
+		},
+		"divf": func(a interface{}, v ...interface{}) float64 {
+			val := toFloat64(a)
+			for _, b := range v {
+				val /= toFloat64(b)
+			}
+			return val
+		},
+		"maxf": func(a interface{}, i ...interface{}) float64 {
+			aa := toFloat64(a)
+			for _, b := range i {
+				aa = math.Max(aa, toFloat64(b))
+			}
+			return aa
+		},
+		"minf": func(a interface{}, i ...interface{}) float64 {
+			aa := toFloat64(a)
+			for _, b := range i {
+				aa = math.Min(aa, toFloat64(b))
+			}
+			return aa
+		},
+		"floor":   func(a interface{}) float64 { return math.Floor(toFloat64(a)) },
+		"ceil":    func(a interface{}) float64 { return math.Ceil(toFloat64(a)) },
+		"round":   round,
+		"int":     func(v interface{}) int { return int(toInt64(v)) },
+		"int64":   toInt64,
+		"float64": toFloat64,
+		"atoi": func(s string) int {
+			i, _ := strconv.Atoi(s)
+			return i
+		},
+	}
+}
+
+// round rounds a number to the given precision, rounding halves up by
+// default or at the optional rounding point
+func round(a interface{}, p int, rOpt ...float64) float64 {
+	roundOn := .5
+	if len(rOpt) > 0 {
+		roundOn = rOpt[0]
+	}
+	val := toFloat64(a)
+	pow := math.Pow(10, float64(p))
+	digit := pow * val
+	_, div := math.Modf(digit)
+	if div >= roundOn {
+		return math.Ceil(digit) / pow
+	}
+	return math.Floor(digit) / pow
+}
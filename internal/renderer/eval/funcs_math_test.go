@@ -0,0 +1,30 @@
+package eval_test
+
+import "testing"
+
+func TestMathFuncs(t *testing.T) {
+	values := map[string]interface{}{"replicas": 3, "ratio": 1.5, "count": "7"}
+	runFuncTests(t, []funcTest{
+		{name: "add", tmpl: `{{ add 1 2 3 }}`, expected: "6"},
+		{name: "add values", tmpl: `{{ add .Values.replicas 1 }}`, values: values, expected: "4"},
+		{name: "add numeric string", tmpl: `{{ add .Values.count 1 }}`, values: values, expected: "8"},
+		{name: "add1", tmpl: `{{ add1 .Values.replicas }}`, values: values, expected: "4"},
+		{name: "sub", tmpl: `{{ sub 10 4 }}`, expected: "6"},
+		{name: "mul", tmpl: `{{ mul 2 3 4 }}`, expected: "24"},
+		{name: "div", tmpl: `{{ div 10 3 }}`, expected: "3"},
+		{name: "div by zero", tmpl: `{{ div 10 0 }}`, wantErr: true},
+		{name: "mod", tmpl: `{{ mod 10 3 }}`, expected: "1"},
+		{name: "max", tmpl: `{{ max 1 5 3 }}`, expected: "5"},
+		{name: "min", tmpl: `{{ min 4 2 8 }}`, expected: "2"},
+		{name: "addf", tmpl: `{{ addf .Values.ratio 1 }}`, values: values, expected: "2.5"},
+		{name: "mulf", tmpl: `{{ mulf .Values.ratio 2 }}`, values: values, expected: "3"},
+		{name: "divf", tmpl: `{{ divf 1 4 }}`, expected: "0.25"},
+		{name: "floor", tmpl: `{{ floor 1.7 }}`, expected: "1"},
+		{name: "ceil", tmpl: `{{ ceil 1.2 }}`, expected: "2"},
+		{name: "round", tmpl: `{{ round 3.14159 2 }}`, expected: "3.14"},
+		{name: "int", tmpl: `{{ int 3.9 }}`, expected: "3"},
+		{name: "float64", tmpl: `{{ float64 "2.5" }}`, expected: "2.5"},
+		{name: "atoi", tmpl: `{{ atoi "42" }}`, expected: "42"},
+		{name: "math result in comparison", tmpl: `{{ add 1 1 | eq 2 }}`, expected: "true"},
+	})
+}
@@ -0,0 +1,349 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"helmish/internal/renderer/types"
+)
+
+// semverFuncs holds the Sprig semantic version functions
+func semverFuncs() types.FuncMap {
+	return types.FuncMap{
+		"semver":        parseSemver,
+		"semverCompare": semverCompare,
+	}
+}
+
+// semverPattern matches a version, allowing missing minor and patch parts and
+// wildcards (x, X, *) when used inside constraints
+var semverPattern = regexp.MustCompile(`^v?([0-9]+|[xX*])(\.([0-9]+|[xX*]))?(\.([0-9]+|[xX*]))?` +
+	`(-([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*))?(\+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*))?$`)
+
+// semverVersion is a parsed semantic version
+type semverVersion struct {
+	major, minor, patch uint64
+	pre                 string
+	metadata            string
+	original            string
+	// Set when the version was written with fewer than three parts or with
+	// wildcards, which widens the constraint it appears in
+	majorDirty bool
+	minorDirty bool
+	patchDirty bool
+	wildcard   bool // set when a part was written as x, X or *
+}
+
+// Major returns the major version
+func (v *semverVersion) Major() uint64 { return v.major }
+
+// Minor returns the minor version
+func (v *semverVersion) Minor() uint64 { return v.minor }
+
+// Patch returns the patch version
+func (v *semverVersion) Patch() uint64 { return v.patch }
+
+// Prerelease returns the pre-release part of the version
+func (v *semverVersion) Prerelease() string { return v.pre }
+
+// Metadata returns the build metadata of the version
+func (v *semverVersion) Metadata() string { return v.metadata }
+
+// Original returns the version as it was written
+func (v *semverVersion) Original() string { return v.original }
+
+// String returns the normalized version
+func (v *semverVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		s += "-" + v.pre
+	}
+	if v.metadata != "" {
+		s += "+" + v.metadata
+	}
+	return s
+}
+
+// parseSemver parses a concrete version; wildcards are not allowed
+func parseSemver(s string) (*semverVersion, error) {
+	v, err := parseVersionPattern(s)
+	if err != nil {
+		return nil, err
+	}
+	if v.wildcard {
+		return nil, fmt.Errorf("invalid semantic version %q", s)
+	}
+	return v, nil
+}
+
+func parseVersionPattern(s string) (*semverVersion, error) {
+	m := semverPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, fmt.Errorf("invalid semantic version %q", s)
+	}
+	v := &semverVersion{original: s, pre: m[7], metadata: m[10]}
+	parts := []string{m[1], m[3], m[5]}
+	nums := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		if p == "" || p == "x" || p == "X" || p == "*" {
+			v.wildcard = p != ""
+			v.majorDirty = i == 0
+			v.minorDirty = i <= 1
+			v.patchDirty = true
+			break
+		}
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// compare orders two versions following semver precedence rules
+func (v *semverVersion) compare(o *semverVersion) int {
+	for _, pair := range [][2]uint64{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.pre, o.pre)
+}
+
+// comparePrerelease orders pre-release strings; a version without a
+// pre-release sorts after any pre-release of the same version
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	ap, bp := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aerr := strconv.ParseUint(ap[i], 10, 64)
+		bn, berr := strconv.ParseUint(bp[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(ap[i], bp[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(ap) < len(bp):
+		return -1
+	case len(ap) > len(bp):
+		return 1
+	}
+	return 0
+}
+
+// semverConstraint is a single operator and version, e.g. >=1.2.3
+type semverConstraint struct {
+	op  string
+	ver *semverVersion
+}
+
+// constraintOps lists the constraint operators, longest first
+var constraintOps = []string{">=", "=>", "<=", "=<", "!=", "==", "~>", ">", "<", "=", "~", "^"}
+
+// semverCompare reports whether version satisfies the constraint. Constraints
+// may be joined with commas or spaces (and) and || (or), and may use
+// wildcards, tilde, caret and hyphen ranges.
+func semverCompare(constraint, version string) (bool, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range strings.Split(constraint, "||") {
+		constraints, err := parseConstraintGroup(group)
+		if err != nil {
+			return false, err
+		}
+		ok := true
+		for _, c := range constraints {
+			if !c.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseConstraintGroup parses the and-joined constraints of one || group
+func parseConstraintGroup(group string) ([]semverConstraint, error) {
+	fields := strings.Fields(strings.ReplaceAll(group, ",", " "))
+	// Join operators separated from their version by a space, e.g. ">= 1.2"
+	var terms []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if isConstraintOp(f) && i+1 < len(fields) {
+			f += fields[i+1]
+			i++
+		}
+		terms = append(terms, f)
+	}
+	var constraints []semverConstraint
+	for i := 0; i < len(terms); i++ {
+		// Hyphen range: 1.2 - 1.4.5 means >=1.2 <=1.4.5
+		if i+2 < len(terms) && terms[i+1] == "-" {
+			lo, err := parseVersionPattern(terms[i])
+			if err != nil {
+				return nil, err
+			}
+			hi, err := parseVersionPattern(terms[i+2])
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, semverConstraint{op: ">=", ver: lo}, semverConstraint{op: "<=", ver: hi})
+			i += 2
+			continue
+		}
+		c, err := parseConstraint(terms[i])
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	if len(constraints) == 0 {
+		return nil, fmt.Errorf("empty constraint")
+	}
+	return constraints, nil
+}
+
+func isConstraintOp(s string) bool {
+	for _, op := range constraintOps {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+func parseConstraint(s string) (semverConstraint, error) {
+	op := ""
+	for _, candidate := range constraintOps {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			break
+		}
+	}
+	v, err := parseVersionPattern(strings.TrimPrefix(s, op))
+	if err != nil {
+		return semverConstraint{}, fmt.Errorf("improper constraint: %s", s)
+	}
+	switch op {
+	case "=>":
+		op = ">="
+	case "=<":
+		op = "<="
+	case "==", "":
+		op = "="
+	case "~>":
+		op = "~"
+	}
+	return semverConstraint{op: op, ver: v}, nil
+}
+
+// check reports whether v satisfies the constraint. Pre-release versions only
+// satisfy constraints that themselves name a pre-release.
+func (c semverConstraint) check(v *semverVersion) bool {
+	if v.pre != "" && c.ver.pre == "" {
+		return false
+	}
+	con := c.ver
+	switch c.op {
+	case "=":
+		if con.minorDirty || con.patchDirty {
+			return c.tilde(v)
+		}
+		return v.compare(con) == 0
+	case "!=":
+		if con.minorDirty || con.patchDirty {
+			return !c.tilde(v)
+		}
+		return v.compare(con) != 0
+	case ">":
+		switch {
+		case con.minorDirty:
+			return v.major > con.major
+		case con.patchDirty:
+			return v.major > con.major || (v.major == con.major && v.minor > con.minor)
+		}
+		return v.compare(con) > 0
+	case "<":
+		return v.compare(con) < 0
+	case ">=":
+		return v.compare(con) >= 0
+	case "<=":
+		switch {
+		case con.minorDirty:
+			return v.major <= con.major
+		case con.patchDirty:
+			return v.major < con.major || (v.major == con.major && v.minor <= con.minor)
+		}
+		return v.compare(con) <= 0
+	case "~":
+		return c.tilde(v)
+	case "^":
+		return c.caret(v)
+	}
+	return false
+}
+
+// tilde allows patch level changes, or minor level changes when no minor
+// version is given: ~1.2.3 is >=1.2.3 <1.3.0, ~1 is >=1.0.0 <2.0.0
+func (c semverConstraint) tilde(v *semverVersion) bool {
+	con := c.ver
+	if con.majorDirty {
+		return true
+	}
+	if v.compare(con) < 0 {
+		return false
+	}
+	if con.minorDirty {
+		return v.major == con.major
+	}
+	return v.major == con.major && v.minor == con.minor
+}
+
+// caret allows changes that do not modify the left-most non-zero part:
+// ^1.2.3 is >=1.2.3 <2.0.0, ^0.2.3 is >=0.2.3 <0.3.0
+func (c semverConstraint) caret(v *semverVersion) bool {
+	con := c.ver
+	if v.compare(con) < 0 {
+		return false
+	}
+	switch {
+	case con.major > 0 || con.minorDirty:
+		return v.major == con.major
+	case con.minor > 0 || con.patchDirty:
+		return v.major == 0 && v.minor == con.minor
+	}
+	return v.major == 0 && v.minor == 0 && v.patch == con.patch
+}
@@ -0,0 +1,30 @@
+package eval_test
+
+import "testing"
+
+func TestSemverFuncs(t *testing.T) {
+	runFuncTests(t, []funcTest{
+		{name: "semver string", tmpl: `{{ semver "v1.2.3-beta.1+build" }}`, expected: "1.2.3-beta.1+build"},
+		{name: "semver invalid", tmpl: `{{ semver "not-a-version" }}`, wantErr: true},
+		{name: "exact match", tmpl: `{{ semverCompare "1.2.3" "1.2.3" }}`, expected: "true"},
+		{name: "greater or equal", tmpl: `{{ semverCompare ">=1.19.0" "1.25.4" }}`, expected: "true"},
+		{name: "less than", tmpl: `{{ semverCompare "<1.19.0" "1.25.4" }}`, expected: "false"},
+		{name: "range with comma", tmpl: `{{ semverCompare ">=1.2.0, <2.0.0" "1.9.9" }}`, expected: "true"},
+		{name: "range with space", tmpl: `{{ semverCompare ">= 1.2.0 < 2.0.0" "2.0.0" }}`, expected: "false"},
+		{name: "or", tmpl: `{{ semverCompare "<1.0.0 || >=3.0.0" "3.1.0" }}`, expected: "true"},
+		{name: "wildcard", tmpl: `{{ semverCompare "1.2.x" "1.2.9" }}`, expected: "true"},
+		{name: "wildcard mismatch", tmpl: `{{ semverCompare "1.2.x" "1.3.0" }}`, expected: "false"},
+		{name: "any", tmpl: `{{ semverCompare "*" "4.5.6" }}`, expected: "true"},
+		{name: "tilde", tmpl: `{{ semverCompare "~1.2.3" "1.2.8" }}`, expected: "true"},
+		{name: "tilde minor bump", tmpl: `{{ semverCompare "~1.2.3" "1.3.0" }}`, expected: "false"},
+		{name: "caret", tmpl: `{{ semverCompare "^1.2.3" "1.9.0" }}`, expected: "true"},
+		{name: "caret major bump", tmpl: `{{ semverCompare "^1.2.3" "2.0.0" }}`, expected: "false"},
+		{name: "caret zero major", tmpl: `{{ semverCompare "^0.2.3" "0.3.0" }}`, expected: "false"},
+		{name: "hyphen range", tmpl: `{{ semverCompare "1.2 - 1.4.5" "1.4.5" }}`, expected: "true"},
+		{name: "prerelease excluded", tmpl: `{{ semverCompare ">=1.19.0" "1.25.0-gke.100" }}`, expected: "false"},
+		{name: "prerelease allowed with -0", tmpl: `{{ semverCompare ">=1.19-0" "v1.25.0-gke.100" }}`, expected: "true"},
+		{name: "not equal", tmpl: `{{ semverCompare "!=1.2.3" "1.2.4" }}`, expected: "true"},
+		{name: "greater than wildcard", tmpl: `{{ semverCompare ">1.x" "1.9.0" }}`, expected: "false"},
+		{name: "invalid constraint", tmpl: `{{ semverCompare ">=abc" "1.0.0" }}`, wantErr: true},
+	})
+}
@@ -0,0 +1,360 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"helmish/internal/renderer/types"
+)
+
+// stringFuncs holds the Sprig string functions
+func stringFuncs() types.FuncMap {
+	return types.FuncMap{
+		"toString":               strval,
+		"toStrings":              toStrings,
+		"upper":                  strings.ToUpper,
+		"lower":                  strings.ToLower,
+		"title":                  title,
+		"untitle":                untitle,
+		"swapcase":               swapcase,
+		"trim":                   strings.TrimSpace,
+		"trimAll":                func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix":             func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix":             func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"contains":               func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":              func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":              func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":                func(old, new, src string) string { return strings.ReplaceAll(src, old, new) },
+		"repeat":                 func(count int, s string) string { return strings.Repeat(s, count) },
+		"substr":                 substr,
+		"trunc":                  trunc,
+		"abbrev":                 abbrev,
+		"nospace":                nospace,
+		"initials":               initials,
+		"quote":                  quote,
+		"squote":                 squote,
+		"cat":                    cat,
+		"indent":                 indent,
+		"nindent":                func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"plural":                 plural,
+		"snakecase":              func(s string) string { return joinWords(splitWords(s), "_", strings.ToLower) },
+		"kebabcase":              func(s string) string { return joinWords(splitWords(s), "-", strings.ToLower) },
+		"camelcase":              camelcase,
+		"split":                  split,
+		"splitList":              splitList,
+		"splitn":                 splitn,
+		"join":                   join,
+		"regexMatch":             regexMatch,
+		"regexFind":              regexFind,
+		"regexFindAll":           regexFindAll,
+		"regexReplaceAll":        regexReplaceAll,
+		"regexReplaceAllLiteral": regexReplaceAllLiteral,
+		"regexSplit":             regexSplit,
+		// The regex functions report invalid expressions as errors, so the
+		// must variants are the same functions
+		"mustRegexMatch":             regexMatch,
+		"mustRegexFind":              regexFind,
+		"mustRegexFindAll":           regexFindAll,
+		"mustRegexReplaceAll":        regexReplaceAll,
+		"mustRegexReplaceAllLiteral": regexReplaceAllLiteral,
+		"mustRegexSplit":             regexSplit,
+	}
+}
+
+func toStrings(v interface{}) ([]interface{}, error) {
+	l, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(l))
+	for i, item := range l {
+		out[i] = strval(item)
+	}
+	return out, nil
+}
+
+// title upper-cases the first letter of every word, where words are
+// separated by anything other than letters, digits and underscores
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if prev != '_' && !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// untitle lower-cases the first letter of every word
+func untitle(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToLower(r)
+		}
+		return r
+	}, s)
+}
+
+func swapcase(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsUpper(r):
+			return unicode.ToLower(r)
+		case unicode.IsLower(r):
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
+
+// substr returns s[start:end], where a negative start means from the
+// beginning and a negative or too large end means to the end
+func substr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if start > len(s) {
+		start = len(s)
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if end < start {
+		return ""
+	}
+	return s[start:end]
+}
+
+// trunc keeps the first c characters of s, or the last -c when c is negative
+func trunc(c int, s string) string {
+	if c < 0 && len(s)+c > 0 {
+		return s[len(s)+c:]
+	}
+	if c >= 0 && len(s) > c {
+		return s[:c]
+	}
+	return s
+}
+
+// abbrev truncates s to width characters, ending it with "..."
+func abbrev(width int, s string) string {
+	if width < 4 || len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
+
+func nospace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func initials(s string) string {
+	var b strings.Builder
+	for _, w := range strings.Fields(s) {
+		for _, r := range w {
+			b.WriteRune(r)
+			break
+		}
+	}
+	return b.String()
+}
+
+// quote wraps each non-nil argument in double quotes and joins them with spaces
+func quote(str ...interface{}) string {
+	out := make([]string, 0, len(str))
+	for _, s := range str {
+		if s != nil {
+			out = append(out, fmt.Sprintf("%q", strval(s)))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// squote wraps each non-nil argument in single quotes and joins them with spaces
+func squote(str ...interface{}) string {
+	out := make([]string, 0, len(str))
+	for _, s := range str {
+		if s != nil {
+			out = append(out, "'"+strval(s)+"'")
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// cat joins the non-nil arguments with spaces
+func cat(v ...interface{}) string {
+	out := make([]string, 0, len(v))
+	for _, s := range v {
+		if s != nil {
+			out = append(out, strval(s))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// indent prefixes every line of s with the given number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func plural(one, many string, count int) string {
+	if count == 1 {
+		return one
+	}
+	return many
+}
+
+// splitWords breaks an identifier into words on case changes, spaces,
+// dashes and underscores
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = nil
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(current))
+				current = nil
+			}
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+func joinWords(words []string, sep string, transform func(string) string) string {
+	for i, w := range words {
+		words[i] = transform(w)
+	}
+	return strings.Join(words, sep)
+}
+
+func camelcase(s string) string {
+	return joinWords(splitWords(s), "", func(w string) string {
+		return strings.ToUpper(w[:1]) + strings.ToLower(w[1:])
+	})
+}
+
+// split splits orig on sep into a dict keyed _0, _1, ...
+func split(sep, orig string) map[string]interface{} {
+	parts := strings.Split(orig, sep)
+	res := make(map[string]interface{}, len(parts))
+	for i, v := range parts {
+		res[fmt.Sprintf("_%d", i)] = v
+	}
+	return res
+}
+
+// splitn splits orig on sep into at most n parts, keyed _0, _1, ...
+func splitn(sep string, n int, orig string) map[string]interface{} {
+	parts := strings.SplitN(orig, sep, n)
+	res := make(map[string]interface{}, len(parts))
+	for i, v := range parts {
+		res[fmt.Sprintf("_%d", i)] = v
+	}
+	return res
+}
+
+func splitList(sep, orig string) []interface{} {
+	parts := strings.Split(orig, sep)
+	res := make([]interface{}, len(parts))
+	for i, v := range parts {
+		res[i] = v
+	}
+	return res
+}
+
+// join joins the elements of a list, converted to strings, with sep
+func join(sep string, v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	l, err := toList(v)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(l))
+	for _, item := range l {
+		if item != nil {
+			parts = append(parts, strval(item))
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func regexMatch(regex, s string) (bool, error) {
+	return regexp.MatchString(regex, s)
+}
+
+func regexFind(regex, s string) (string, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return r.FindString(s), nil
+}
+
+func regexFindAll(regex, s string, n int) ([]interface{}, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	matches := r.FindAllString(s, n)
+	res := make([]interface{}, len(matches))
+	for i, m := range matches {
+		res[i] = m
+	}
+	return res, nil
+}
+
+func regexReplaceAll(regex, s, repl string) (string, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
+
+func regexReplaceAllLiteral(regex, s, repl string) (string, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllLiteralString(s, repl), nil
+}
+
+func regexSplit(regex, s string, n int) ([]interface{}, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	parts := r.Split(s, n)
+	res := make([]interface{}, len(parts))
+	for i, p := range parts {
+		res[i] = p
+	}
+	return res, nil
+}
@@ -0,0 +1,47 @@
+package eval_test
+
+import "testing"
+
+func TestStringFuncs(t *testing.T) {
+	values := map[string]interface{}{"name": "  My App  ", "port": 8080, "words": []interface{}{"a", "b", "c"}}
+	runFuncTests(t, []funcTest{
+		{name: "quote string", tmpl: `{{ "hello" | quote }}`, expected: `"hello"`},
+		{name: "quote number", tmpl: `{{ .Values.port | quote }}`, values: values, expected: `"8080"`},
+		{name: "quote escapes", tmpl: `{{ quote "a\"b" }}`, expected: `"a\"b"`},
+		{name: "squote", tmpl: `{{ squote "x" }}`, expected: `'x'`},
+		{name: "trim upper", tmpl: `{{ .Values.name | trim | upper }}`, values: values, expected: "MY APP"},
+		{name: "lower", tmpl: `{{ lower "ABC" }}`, expected: "abc"},
+		{name: "title", tmpl: `{{ title "hello wide-world" }}`, expected: "Hello Wide-World"},
+		{name: "trimPrefix trimSuffix", tmpl: `{{ "v1.2.3-rc" | trimPrefix "v" | trimSuffix "-rc" }}`, expected: "1.2.3"},
+		{name: "trimAll", tmpl: `{{ trimAll "$" "$5.00$" }}`, expected: "5.00"},
+		{name: "contains", tmpl: `{{ contains "cat" "catch" }}`, expected: "true"},
+		{name: "hasPrefix", tmpl: `{{ hasPrefix "cat" "catch" }}`, expected: "true"},
+		{name: "replace", tmpl: `{{ "a.b.c" | replace "." "-" }}`, expected: "a-b-c"},
+		{name: "repeat", tmpl: `{{ repeat 3 "ab" }}`, expected: "ababab"},
+		{name: "substr", tmpl: `{{ substr 0 5 "hello world" }}`, expected: "hello"},
+		{name: "trunc", tmpl: `{{ trunc 5 "hello world" }}`, expected: "hello"},
+		{name: "trunc negative", tmpl: `{{ trunc -5 "hello world" }}`, expected: "world"},
+		{name: "trunc 63 trimSuffix", tmpl: `{{ "release-name-" | trunc 63 | trimSuffix "-" }}`, expected: "release-name"},
+		{name: "abbrev", tmpl: `{{ abbrev 5 "hello world" }}`, expected: "he..."},
+		{name: "nospace", tmpl: `{{ nospace "a b  c" }}`, expected: "abc"},
+		{name: "initials", tmpl: `{{ initials "First Try" }}`, expected: "FT"},
+		{name: "cat", tmpl: `{{ cat "hello" "beautiful" "world" }}`, expected: "hello beautiful world"},
+		{name: "indent", tmpl: `{{ "a\nb" | indent 2 }}`, expected: "  a\n  b"},
+		{name: "nindent", tmpl: `{{ "a\nb" | nindent 4 }}`, expected: "\n    a\n    b"},
+		{name: "plural", tmpl: `{{ plural "one" "many" 2 }}`, expected: "many"},
+		{name: "snakecase", tmpl: `{{ snakecase "FirstName" }}`, expected: "first_name"},
+		{name: "kebabcase", tmpl: `{{ kebabcase "FirstName" }}`, expected: "first-name"},
+		{name: "camelcase", tmpl: `{{ camelcase "http_server" }}`, expected: "HttpServer"},
+		{name: "swapcase", tmpl: `{{ swapcase "Hello" }}`, expected: "hELLO"},
+		{name: "toString", tmpl: `{{ toString 42 | quote }}`, expected: `"42"`},
+		{name: "join", tmpl: `{{ join "," .Values.words }}`, values: values, expected: "a,b,c"},
+		{name: "splitList join", tmpl: `{{ splitList "." "a.b.c" | join "/" }}`, expected: "a/b/c"},
+		{name: "split", tmpl: `{{ split "$" "foo$bar" }}`, expected: "map[_0:foo _1:bar]"},
+		{name: "regexMatch", tmpl: `{{ regexMatch "^[a-z]+$" "abc" }}`, expected: "true"},
+		{name: "regexReplaceAll", tmpl: `{{ regexReplaceAll "a(x*)b" "-ab-axxb-" "${1}W" }}`, expected: "-W-xxW-"},
+		{name: "regexFind", tmpl: `{{ regexFind "[0-9]+" "abc123def" }}`, expected: "123"},
+		{name: "wrong argument type", tmpl: `{{ upper 3 }}`, wantErr: true},
+		{name: "mustRegexFind", tmpl: `{{ mustRegexFind "[0-9]+" "abc123def" }}`, expected: "123"},
+		{name: "mustRegexMatch invalid", tmpl: `{{ mustRegexMatch "[" "abc" }}`, wantErr: true},
+	})
+}
@@ -0,0 +1,107 @@
+package eval_test
+
+import (
+	"strings"
+	"testing"
+
+	"helmish/internal/renderer/ast"
+	"helmish/internal/renderer/eval"
+	tokens "helmish/internal/renderer/tokenizer"
+	"helmish/internal/renderer/types"
+)
+
+// funcTest is a single template rendered against a set of values
+type funcTest struct {
+	name     string
+	tmpl     string
+	values   map[string]interface{}
+	expected string
+	wantErr  bool
+}
+
+// renderTemplate tokenizes, parses and evaluates a template string
+func renderTemplate(tmpl string, values map[string]interface{}) (string, error) {
+	var blocks types.DocumentBlocks
+	for i, line := range strings.Split(tmpl, "\n") {
+		blocks.Blocks = append(blocks.Blocks, types.Block{
+			Line:    i + 1,
+			Type:    types.TemplateBlockType,
+			Content: &types.TemplateBlock{RawContent: line},
+		})
+	}
+	nodes, err := ast.ParseAST(tokens.Tokenize(blocks))
+	if err != nil {
+		return "", err
+	}
+	ctx := eval.NewEvalContext(values, map[string]interface{}{"Name": "test"})
+	result, err := eval.EvaluateAST(nodes, ctx)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, tok := range result {
+		out.WriteString(tok.Value)
+	}
+	return out.String(), nil
+}
+
+func runFuncTests(t *testing.T, tests []funcTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate(tt.tmpl, tt.values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got output %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDefaultFuncs(t *testing.T) {
+	runFuncTests(t, []funcTest{
+		{name: "default on missing value", tmpl: `{{ .Values.tag | default "latest" }}`, values: map[string]interface{}{}, expected: "latest"},
+		{name: "default on empty string", tmpl: `{{ .Values.tag | default "latest" }}`, values: map[string]interface{}{"tag": ""}, expected: "latest"},
+		{name: "default keeps set value", tmpl: `{{ .Values.tag | default "latest" }}`, values: map[string]interface{}{"tag": "v1"}, expected: "v1"},
+		{name: "default on zero number", tmpl: `{{ .Values.replicas | default 3 }}`, values: map[string]interface{}{"replicas": 0}, expected: "3"},
+		{name: "default chained with field", tmpl: `{{ .Values.tag | default .Chart.Name | quote }}`, values: map[string]interface{}{}, expected: `"test"`},
+		{name: "empty on empty list", tmpl: `{{ empty .Values.items }}`, values: map[string]interface{}{"items": []interface{}{}}, expected: "true"},
+		{name: "empty on non-empty map", tmpl: `{{ empty .Values.m }}`, values: map[string]interface{}{"m": map[string]interface{}{"a": 1}}, expected: "false"},
+		{name: "coalesce", tmpl: `{{ coalesce .Values.a .Values.b "c" }}`, values: map[string]interface{}{"a": "", "b": "bee"}, expected: "bee"},
+		{name: "ternary", tmpl: `{{ ternary "yes" "no" .Values.on }}`, values: map[string]interface{}{"on": true}, expected: "yes"},
+		{name: "kindOf", tmpl: `{{ kindOf .Values.m }}`, values: map[string]interface{}{"m": map[string]interface{}{}}, expected: "map"},
+		{name: "unknown function is an error", tmpl: `{{ nosuchfunc 1 }}`, values: map[string]interface{}{}, wantErr: true},
+		{name: "required set value", tmpl: `{{ required "tag is required" .Values.tag }}`, values: map[string]interface{}{"tag": "v1"}, expected: "v1"},
+		{name: "required keeps zero number", tmpl: `{{ required "replicas is required" .Values.replicas }}`, values: map[string]interface{}{"replicas": 0}, expected: "0"},
+		{name: "required missing value", tmpl: `{{ required "tag is required" .Values.tag }}`, values: map[string]interface{}{}, wantErr: true},
+		{name: "required empty string", tmpl: `{{ required "tag is required" .Values.tag }}`, values: map[string]interface{}{"tag": ""}, wantErr: true},
+		{name: "fail", tmpl: `{{ fail "unsupported" }}`, values: map[string]interface{}{}, wantErr: true},
+	})
+}
+
+func TestTplFunc(t *testing.T) {
+	values := map[string]interface{}{
+		"name":   "web",
+		"host":   "{{ .Values.name }}.example.com",
+		"define": `{{ define "local" }}[{{ .Values.name }}]{{ end }}{{ include "local" . }}`,
+		"item":   "{{ .a }}",
+		"data":   map[string]interface{}{"a": "x"},
+		"broken": "{{ if }}x{{ end }}",
+	}
+	runFuncTests(t, []funcTest{
+		{name: "tpl renders values", tmpl: `{{ tpl .Values.host . }}`, values: values, expected: "web.example.com"},
+		{name: "tpl with other data", tmpl: `{{ tpl .Values.item .Values.data }}`, values: values, expected: "x"},
+		{name: "tpl sees its own defines", tmpl: `{{ tpl .Values.define . }}`, values: values, expected: "[web]"},
+		{name: "tpl defines do not leak", tmpl: `{{ tpl .Values.define . }}{{ include "local" . }}`, values: values, wantErr: true},
+		{name: "tpl output is piped", tmpl: `{{ tpl .Values.host . | upper }}`, values: values, expected: "WEB.EXAMPLE.COM"},
+		{name: "tpl reports template errors", tmpl: `{{ tpl .Values.broken . }}`, values: values, wantErr: true},
+	})
+}
@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"helmish/internal/renderer/ast"
+	tokens "helmish/internal/renderer/tokenizer"
+	"helmish/internal/renderer/types"
+)
+
+// namedTemplate is the body of a {{ define }} block
+type namedTemplate struct {
+	body []ast.Node
+}
+
+// Execute evaluates the template body, applying whitespace trimming within it
+func (t namedTemplate) Execute(ctx *types.EvalContext) ([]types.Token, error) {
+	return EvaluateAST(t.body, ctx)
+}
+
+// CollectTemplates adds the {{ define }} blocks found at the top level of
+// nodes to templates. A later definition of the same name replaces an
+// earlier one, as in Helm.
+func CollectTemplates(nodes []ast.Node, templates types.Templates) {
+	for _, node := range nodes {
+		if def, ok := node.(*ast.DefineNode); ok {
+			templates[def.Name] = namedTemplate{body: def.Body}
+		}
+	}
+}
+
+// includeFunc returns the include function bound to the context's named
+// templates. Unlike {{ template }}, include returns the output as a string
+// so it can be piped into other functions.
+func includeFunc(ctx *types.EvalContext) func(string, interface{}) (string, error) {
+	return func(name string, data interface{}) (string, error) {
+		return ast.ExecuteTemplate(ctx, name, data)
+	}
+}
+
+// tplFunc returns the tpl function bound to the context's named templates.
+// tpl renders a string as a template with data as both . and $. Like Helm,
+// templates defined in the string are only visible while it renders.
+func tplFunc(ctx *types.EvalContext) func(string, interface{}) (string, error) {
+	return func(text string, data interface{}) (string, error) {
+		nodes, err := ast.ParseAST(tokens.TokenizeSource(text))
+		if err != nil {
+			return "", fmt.Errorf("error parsing tpl: %v", err)
+		}
+		leave, err := ctx.EnterTemplate("tpl")
+		if err != nil {
+			return "", err
+		}
+		defer leave()
+		tplCtx := ctx.ForTemplate(data)
+		tplCtx.Templates = make(types.Templates, len(ctx.Templates))
+		for name, t := range ctx.Templates {
+			tplCtx.Templates[name] = t
+		}
+		CollectTemplates(nodes, tplCtx.Templates)
+		bindTemplateFuncs(tplCtx)
+		result, err := EvaluateAST(nodes, tplCtx)
+		if err != nil {
+			if ctx.Calls.Err != nil {
+				return "", ctx.Calls.Err
+			}
+			return "", fmt.Errorf("error calling tpl: %v", err)
+		}
+		var sb strings.Builder
+		for _, tok := range result {
+			sb.WriteString(tok.Value)
+		}
+		return sb.String(), nil
+	}
+}
+
+// bindTemplateFuncs registers include and tpl on a copy of the context's
+// functions, bound to its named templates
+func bindTemplateFuncs(ctx *types.EvalContext) {
+	funcs := make(types.FuncMap, len(ctx.Funcs)+2)
+	for name, fn := range ctx.Funcs {
+		funcs[name] = fn
+	}
+	funcs["include"] = includeFunc(ctx)
+	funcs["tpl"] = tplFunc(ctx)
+	ctx.Funcs = funcs
+}
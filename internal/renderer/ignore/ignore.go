@@ -0,0 +1,202 @@
+// Package ignore implements the .helmignore rules that exclude files from a
+// chart. The syntax is the one of .gitignore: patterns match base names at
+// any depth unless they contain a slash, a trailing slash only matches
+// directories, ** matches any number of directories and ! re-includes what
+// an earlier pattern excluded.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// HelmIgnore is the name of the ignore file at the root of a chart
+const HelmIgnore = ".helmignore"
+
+// Defaults are the rules every chart has, parsed before its .helmignore. Like
+// helm, hidden files in templates/ such as editor swap files are ignored.
+const Defaults = "templates/.?*\n"
+
+// Rules is a parsed .helmignore file
+type Rules struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	raw     string
+	re      *regexp.Regexp
+	negate  bool // the pattern started with !, so it re-includes paths
+	dirOnly bool // the pattern ended with /, so it only matches directories
+}
+
+// Parse parses the content of a .helmignore file. Blank lines and lines
+// starting with # are skipped; a leading \ escapes a # or ! that is part of
+// the pattern.
+func Parse(content string) (*Rules, error) {
+	r := &Rules{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := pattern{raw: line}
+		glob := line
+		switch {
+		case strings.HasPrefix(glob, "!"):
+			p.negate = true
+			glob = glob[1:]
+		case strings.HasPrefix(glob, `\!`), strings.HasPrefix(glob, `\#`):
+			glob = glob[1:]
+		}
+		if strings.HasSuffix(glob, "/") {
+			p.dirOnly = true
+			glob = strings.TrimSuffix(glob, "/")
+		}
+		// A pattern with a slash is relative to the chart root, others match
+		// at any depth
+		if strings.Contains(glob, "/") {
+			glob = strings.TrimPrefix(glob, "/")
+		} else {
+			glob = "**/" + glob
+		}
+		re, err := compile(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", HelmIgnore, line, err)
+		}
+		p.re = re
+		r.patterns = append(r.patterns, p)
+	}
+	return r, scanner.Err()
+}
+
+// compile translates a slash-separated glob to a regular expression matching
+// whole paths
+func compile(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	segments := strings.Split(glob, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		if seg == "**" {
+			if last {
+				b.WriteString(".*")
+			} else {
+				b.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		if err := compileSegment(&b, seg); err != nil {
+			return nil, err
+		}
+		if !last {
+			b.WriteString("/")
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// compileSegment translates the glob of a single path element. Wildcards
+// never match a slash.
+func compileSegment(b *strings.Builder, seg string) error {
+	for i := 0; i < len(seg); i++ {
+		switch c := seg[i]; c {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			if i+1 == len(seg) {
+				return fmt.Errorf("trailing backslash")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(seg[i : i+1]))
+		case '[':
+			end := classEnd(seg, i)
+			if end < 0 {
+				return fmt.Errorf("unterminated character class")
+			}
+			b.WriteString("[")
+			j := i + 1
+			if seg[j] == '!' || seg[j] == '^' {
+				b.WriteString("^")
+				j++
+			}
+			for ; j < end; j++ {
+				switch seg[j] {
+				case '\\':
+					j++
+					b.WriteString(regexp.QuoteMeta(seg[j : j+1]))
+				case '[':
+					b.WriteString(`\[`)
+				default:
+					b.WriteByte(seg[j])
+				}
+			}
+			b.WriteString("]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(seg[i : i+1]))
+		}
+	}
+	return nil
+}
+
+// classEnd returns the index of the ] closing the character class opened at
+// start, or -1. A ] right after the opening bracket or its negation is
+// literal.
+func classEnd(seg string, start int) int {
+	i := start + 1
+	if i < len(seg) && (seg[i] == '!' || seg[i] == '^') {
+		i++
+	}
+	if i < len(seg) && seg[i] == ']' {
+		i++
+	}
+	for ; i < len(seg); i++ {
+		switch seg[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// Ignore reports whether the slash-separated path, relative to the chart
+// root, is excluded. The last pattern matching the path decides. Like git, a
+// path inside an excluded directory cannot be re-included.
+func (r *Rules) Ignore(name string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	name = strings.Trim(path.Clean(name), "/")
+	if name == "." || name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && r.match(name[:i], true) {
+			return true
+		}
+	}
+	return r.match(name, isDir)
+}
+
+// match applies the patterns to a single path, ignoring its parents
+func (r *Rules) match(name string, isDir bool) bool {
+	ignored := false
+	for _, p := range r.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
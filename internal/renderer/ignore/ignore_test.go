@@ -0,0 +1,92 @@
+package ignore
+
+import "testing"
+
+func TestIgnore(t *testing.T) {
+	rules, err := Parse("# comment\n\n*.bak\nsecrets/\ndocs/*.md\n")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{name: "base name pattern at the root", path: "notes.bak", expected: true},
+		{name: "base name pattern in a subdirectory", path: "config/app.bak", expected: true},
+		{name: "directory pattern", path: "secrets", isDir: true, expected: true},
+		{name: "directory pattern does not match files", path: "secrets", expected: false},
+		{name: "files in an ignored directory", path: "secrets/key.pem", expected: true},
+		{name: "path pattern", path: "docs/intro.md", expected: true},
+		{name: "path pattern does not match deeper", path: "docs/api/intro.md", expected: false},
+		{name: "not ignored", path: "config/app.yaml", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Ignore(tt.path, tt.isDir); got != tt.expected {
+				t.Errorf("Ignore(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIgnore_Patterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{name: "negation re-includes", rules: "*.yaml\n!keep.yaml\n", path: "templates/keep.yaml", expected: false},
+		{name: "negation leaves other matches", rules: "*.yaml\n!keep.yaml\n", path: "templates/drop.yaml", expected: true},
+		{name: "last matching pattern wins", rules: "!keep.yaml\n*.yaml\n", path: "keep.yaml", expected: true},
+		{name: "no re-include inside an ignored directory", rules: "build/\n!build/keep.txt\n", path: "build/keep.txt", expected: true},
+		{name: "leading slash anchors to the root", rules: "/ci\n", path: "sub/ci", expected: false},
+		{name: "leading slash at the root", rules: "/ci\n", path: "ci", expected: true},
+		{name: "leading double star", rules: "**/fixtures\n", path: "a/b/fixtures", isDir: true, expected: true},
+		{name: "trailing double star", rules: "tmp/**\n", path: "tmp/a/b.txt", expected: true},
+		{name: "trailing double star not the directory", rules: "tmp/**\n", path: "tmp", isDir: true, expected: false},
+		{name: "inner double star matches no directory", rules: "a/**/b.txt\n", path: "a/b.txt", expected: true},
+		{name: "inner double star matches directories", rules: "a/**/b.txt\n", path: "a/x/y/b.txt", expected: true},
+		{name: "star does not cross directories", rules: "templates/*.yaml\n", path: "templates/sub/x.yaml", expected: false},
+		{name: "question mark", rules: "*.sw?\n", path: "templates/.x.swp", expected: true},
+		{name: "character class", rules: "*.[ch]\n", path: "src/x.c", expected: true},
+		{name: "negated character class", rules: "*.[!ch]\n", path: "src/x.c", expected: false},
+		{name: "escaped hash", rules: "\\#notes\n", path: "#notes", expected: true},
+		{name: "escaped bang", rules: "\\!important\n", path: "!important", expected: true},
+		{name: "trailing tilde backups", rules: "*~\n", path: "templates/deployment.yaml~", expected: true},
+		{name: "defaults ignore hidden templates", rules: Defaults, path: "templates/.deployment.yaml.swp", expected: true},
+		{name: "defaults keep other hidden files", rules: Defaults, path: ".env", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.rules)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := rules.Ignore(tt.path, tt.isDir); got != tt.expected {
+				t.Errorf("Ignore(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIgnore_NilRules(t *testing.T) {
+	var rules *Rules
+	if rules.Ignore("templates/x.yaml", false) {
+		t.Errorf("nil rules ignored a path")
+	}
+}
+
+func TestParse_InvalidPattern(t *testing.T) {
+	for _, rules := range []string{"[unclosed\n", "trailing\\\n"} {
+		if _, err := Parse(rules); err == nil {
+			t.Errorf("Parse(%q): expected an error, got none", rules)
+		}
+	}
+}
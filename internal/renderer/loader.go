@@ -0,0 +1,465 @@
+package renderer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"helmish/internal/renderer/ignore"
+	"helmish/internal/renderer/profile"
+	"helmish/internal/renderer/schema"
+	"helmish/internal/renderer/types"
+)
+
+// LoadChart loads the chart from the given path, which is either a chart
+// directory or a gzipped chart archive as built by helm package
+func LoadChart(path string) (types.Chart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Chart{}, err
+	}
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return types.Chart{}, err
+		}
+		defer f.Close()
+		return LoadArchive(f, path)
+	}
+	return LoadFS(os.DirFS(path), path)
+}
+
+// LoadFS loads the chart at the root of a file system, e.g. an
+// fstest.MapFS. path names the chart in errors and becomes its Path.
+func LoadFS(fsys fs.FS, path string) (types.Chart, error) {
+	chart, err := loadFS(fsys, path)
+	if err != nil && path != "" {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return chart, err
+}
+
+// LoadFiles loads a chart from memory. files maps the slash separated paths
+// of the chart's files to their content.
+func LoadFiles(files map[string][]byte, path string) (types.Chart, error) {
+	return LoadFS(memFS(files), path)
+}
+
+// LoadArchive loads a chart from a gzipped tarball. Like the archives built
+// by helm package, every file must be inside a single top-level directory.
+func LoadArchive(r io.Reader, path string) (types.Chart, error) {
+	files, err := readArchive(r)
+	if err != nil {
+		if path != "" {
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+		return types.Chart{}, err
+	}
+	return LoadFiles(files, path)
+}
+
+// readArchive reads the regular files of a chart archive, stripping the
+// top-level directory from their paths
+func readArchive(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	root := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "./"))
+		top, rest, ok := strings.Cut(name, "/")
+		if !ok || !fs.ValidPath(rest) {
+			return nil, fmt.Errorf("invalid file %q in chart archive", hdr.Name)
+		}
+		if root == "" {
+			root = top
+		} else if top != root {
+			return nil, fmt.Errorf("chart archive holds more than one top-level directory: %s, %s", root, top)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[rest] = content
+	}
+	if len(files) == 0 {
+		return nil, errors.New("empty chart archive")
+	}
+	return files, nil
+}
+
+func loadFS(fsys fs.FS, chartPath string) (types.Chart, error) {
+	chart := types.Chart{
+		Path:          chartPath,
+		FS:            fsys,
+		Values:        make(types.Values),
+		Metadata:      make(types.Metadata),
+		YamlTemplates: make(types.YamlTemplates),
+		TplFiles:      make(types.TplFiles),
+		Files:         make(types.ChartFiles),
+	}
+
+	rules, err := loadIgnore(fsys)
+	if err != nil {
+		return chart, err
+	}
+
+	// Load Chart.yaml for metadata. It cannot be ignored.
+	content, err := fs.ReadFile(fsys, "Chart.yaml")
+	if err != nil {
+		return chart, err
+	}
+	var parsed interface{}
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return chart, err
+	}
+	chart.Metadata["Chart.yaml"] = types.ValueData{
+		Raw:    string(content),
+		Parsed: normalizeChartMetadata(parsed),
+	}
+
+	// Load values.yaml for values. Like helm, a chart without one has no
+	// default values.
+	if content, err := readChartFile(fsys, rules, &chart, DefaultValuesFile); err == nil {
+		var parsed interface{}
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			return chart, err
+		}
+		chart.Values[DefaultValuesFile] = types.ValueData{
+			Raw:    string(content),
+			Parsed: parsed,
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return chart, err
+	}
+
+	// Load values.schema.json, if any; values are validated against it
+	// before rendering
+	if content, err := readChartFile(fsys, rules, &chart, schema.File); err == nil {
+		chart.Schema = content
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return chart, err
+	}
+
+	// Load templates. The templates directory must exist.
+	err = fs.WalkDir(fsys, "templates", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ignored(&chart, rules, p, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		// Like helm, partials never produce output and NOTES.txt is
+		// rendered on its own. Other files are not templates.
+		relPath := strings.TrimPrefix(p, "templates/")
+		switch {
+		case relPath == NotesFile:
+			chart.Notes = string(content)
+		case strings.HasPrefix(path.Base(p), "_"), path.Ext(p) == ".tpl":
+			chart.TplFiles[relPath] = string(content)
+		case path.Ext(p) == ".yaml", path.Ext(p) == ".yml", path.Ext(p) == ".json":
+			chart.YamlTemplates[relPath] = string(content)
+		}
+		return nil
+	})
+	if err != nil {
+		return chart, err
+	}
+
+	if err := loadCRDs(fsys, rules, &chart); err != nil {
+		return chart, err
+	}
+
+	if err := loadFiles(fsys, rules, &chart); err != nil {
+		return chart, err
+	}
+
+	if err := loadSubcharts(fsys, rules, &chart); err != nil {
+		return chart, err
+	}
+
+	// crds/ is walked twice, for the CRDs and for .Files
+	sort.Strings(chart.Ignored)
+	chart.Ignored = slices.Compact(chart.Ignored)
+	return chart, nil
+}
+
+// loadIgnore parses the .helmignore of a chart on top of the default rules
+func loadIgnore(fsys fs.FS) (*ignore.Rules, error) {
+	content, err := fs.ReadFile(fsys, ignore.HelmIgnore)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return ignore.Parse(ignore.Defaults + string(content))
+}
+
+// ignored reports whether .helmignore excludes a path of the chart, and
+// records it in the chart's Ignored paths if so
+func ignored(chart *types.Chart, rules *ignore.Rules, p string, isDir bool) bool {
+	if !rules.Ignore(p, isDir) {
+		return false
+	}
+	chart.Ignored = append(chart.Ignored, p)
+	return true
+}
+
+// readChartFile reads a file at the root of the chart. An ignored file does
+// not exist.
+func readChartFile(fsys fs.FS, rules *ignore.Rules, chart *types.Chart, name string) ([]byte, error) {
+	if _, err := fs.Stat(fsys, name); err != nil {
+		return nil, err
+	}
+	if ignored(chart, rules, name, false) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// loadCRDs loads the files of the crds/ directory, if any. They are not
+// templates.
+func loadCRDs(fsys fs.FS, rules *ignore.Rules, chart *types.Chart) error {
+	chart.CRDs = make(types.ChartFiles)
+	err := fs.WalkDir(fsys, "crds", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ignored(chart, rules, p, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		chart.CRDs[strings.TrimPrefix(p, "crds/")] = content
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadSubcharts loads the charts in the charts/ directory, unpacked or
+// archived, as the dependencies of the chart
+func loadSubcharts(fsys fs.FS, rules *ignore.Rules, chart *types.Chart) error {
+	entries, err := fs.ReadDir(fsys, "charts")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join("charts", e.Name())
+		if ignored(chart, rules, name, e.IsDir()) {
+			continue
+		}
+		subPath := path.Join(filepath.ToSlash(chart.Path), name)
+		var sub types.Chart
+		switch {
+		case e.IsDir():
+			var subFS fs.FS
+			if subFS, err = fs.Sub(fsys, name); err != nil {
+				return err
+			}
+			sub, err = loadFS(subFS, subPath)
+		case strings.HasSuffix(e.Name(), ".tgz"):
+			var f fs.File
+			if f, err = fsys.Open(name); err != nil {
+				return err
+			}
+			sub, err = LoadArchive(f, "")
+			sub.Path = subPath
+			f.Close()
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("subchart %s: %w", e.Name(), err)
+		}
+		for _, p := range sub.Ignored {
+			chart.Ignored = append(chart.Ignored, path.Join(name, p))
+		}
+		chart.Dependencies = append(chart.Dependencies, sub)
+	}
+	return nil
+}
+
+// chartFileExcluded lists the files and directories of a chart that are not
+// part of .Files because they have a meaning of their own
+var chartFileExcluded = map[string]bool{
+	"Chart.yaml":        true,
+	"Chart.lock":        true,
+	DefaultValuesFile:   true,
+	schema.File:         true,
+	"requirements.yaml": true,
+	"requirements.lock": true,
+	ignore.HelmIgnore:   true,
+	"templates":         true,
+	"charts":            true,
+	profile.Dir:         true,
+}
+
+// loadFiles loads the chart files exposed to templates as .Files, skipping
+// templates, subcharts and paths matched by .helmignore
+func loadFiles(fsys fs.FS, rules *ignore.Rules, chart *types.Chart) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if (!strings.Contains(p, "/") && chartFileExcluded[p]) || ignored(chart, rules, p, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		chart.Files[p] = content
+		return nil
+	})
+}
+
+// memFS is a read-only file system holding files in memory, keyed by their
+// slash separated paths. Directories are implied by the paths.
+type memFS map[string][]byte
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if content, ok := m[name]; ok {
+		return &memFile{info: memInfo{name: path.Base(name), size: int64(len(content))}, r: bytes.NewReader(content)}, nil
+	}
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := make(map[string]bool)
+	for p := range m {
+		if rest, ok := strings.CutPrefix(p, prefix); ok {
+			child, _, isDir := strings.Cut(rest, "/")
+			children[child] = children[child] || isDir
+		}
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	dir := &memDir{info: memInfo{name: path.Base(name), dir: true}}
+	for child, isDir := range children {
+		dir.entries = append(dir.entries, fs.FileInfoToDirEntry(memInfo{name: child, dir: isDir, size: int64(len(m[path.Join(name, child)]))}))
+	}
+	sort.Slice(dir.entries, func(i, j int) bool { return dir.entries[i].Name() < dir.entries[j].Name() })
+	return dir, nil
+}
+
+// memInfo describes a file or directory of a memFS
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// memFile is an open file of a memFS
+type memFile struct {
+	info memInfo
+	r    *bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is an open directory of a memFS
+type memDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
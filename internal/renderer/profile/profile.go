@@ -0,0 +1,308 @@
+// Package profile loads render profiles from YAML files. A profile named
+// staging is read from staging.yaml (or staging.yml) in one of the profile
+// directories:
+//
+//	values:
+//	  replicaCount: 2
+//	release:
+//	  name: web
+//	  namespace: staging
+//	  revision: 3
+//	  upgrade: true
+//	capabilities:
+//	  kubeVersion: "1.28"
+//	  apiVersions: [v1, apps/v1, networking.k8s.io/v1]
+//
+// A profile may extend others with extends: [base, eu-common]. The parents
+// are merged first, in the order listed, and the profile's own settings are
+// merged last: values are deep-merged, lists and other settings replace.
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"helmish/internal/renderer/types"
+	"helmish/internal/renderer/values"
+)
+
+// Dir is the directory inside a chart that holds its profiles
+const Dir = "profiles"
+
+// Default is the profile used when none is named. It needs no file.
+const Default = "default"
+
+// extensions lists the file extensions of profile files, in lookup order
+var extensions = []string{".yaml", ".yml"}
+
+// file is the on-disk format of a profile
+type file struct {
+	Extends      []string               `yaml:"extends"`
+	Values       map[string]interface{} `yaml:"values"`
+	Release      releaseFile            `yaml:"release"`
+	Capabilities capabilitiesFile       `yaml:"capabilities"`
+}
+
+type releaseFile struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Revision  int    `yaml:"revision"`
+	Upgrade   *bool  `yaml:"upgrade"`
+	Service   string `yaml:"service"`
+}
+
+type capabilitiesFile struct {
+	KubeVersion string   `yaml:"kubeVersion"`
+	APIVersions []string `yaml:"apiVersions"`
+}
+
+// Source is a directory of profile files
+type Source struct {
+	FS  fs.FS
+	Dir string // the path of the directory, used in errors and layer paths
+}
+
+// DirSource returns the source for a directory on disk
+func DirSource(dir string) Source {
+	return Source{FS: os.DirFS(dir), Dir: dir}
+}
+
+// Load reads the named profile from the first directory that has it and
+// resolves the profiles it extends. The default profile is empty unless a
+// file for it exists. An unknown name is an error listing the available
+// profiles.
+func Load(name string, dirs ...string) (types.Profile, error) {
+	sources := make([]Source, len(dirs))
+	for i, dir := range dirs {
+		sources[i] = DirSource(dir)
+	}
+	return LoadFrom(name, sources...)
+}
+
+// LoadFrom is like Load, reading the profile files from the sources
+func LoadFrom(name string, sources ...Source) (types.Profile, error) {
+	if name == "" {
+		name = Default
+	}
+	r := &resolver{sources: sources, done: make(map[string]bool)}
+	if err := r.resolve(name, nil); err != nil {
+		return types.Profile{}, err
+	}
+	if len(r.files) == 0 {
+		return types.Profile{Name: Default}, nil
+	}
+	merged := file{}
+	profile := types.Profile{Name: name}
+	for _, f := range r.files {
+		merge(&merged, f.file)
+		profile.Chain = append(profile.Chain, f.layer())
+	}
+	profile.Capabilities = merged.capabilities()
+	profile.Release = merged.release()
+	profile.Values = merged.Values
+	return profile, nil
+}
+
+// loadedFile is a parsed profile file
+type loadedFile struct {
+	name string
+	path string
+	file file
+}
+
+// layer describes what the file itself declares
+func (f loadedFile) layer() types.ProfileLayer {
+	return types.ProfileLayer{
+		Name:         f.name,
+		Path:         f.path,
+		Extends:      f.file.Extends,
+		Capabilities: f.file.capabilities(),
+		Release:      f.file.release(),
+		Values:       f.file.Values,
+	}
+}
+
+// resolver linearizes a profile and its parents, base first. A profile
+// reached through several parents is included once, at its first position.
+type resolver struct {
+	sources []Source
+	done    map[string]bool
+	files   []loadedFile
+}
+
+// resolve adds the named profile and its parents to the chain. stack holds
+// the profiles currently being resolved, to detect cycles.
+func (r *resolver) resolve(name string, stack []string) error {
+	for i, s := range stack {
+		if s == name {
+			return fmt.Errorf("profile cycle: %s", strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+	if r.done[name] {
+		return nil
+	}
+	src, path, err := find(name, r.sources)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		if name == Default && len(stack) == 0 {
+			return nil
+		}
+		err := r.notFound(name)
+		if len(stack) > 0 {
+			err = fmt.Errorf("profile %q extends %w", stack[len(stack)-1], err)
+		}
+		return err
+	}
+	f, err := read(src, path)
+	if err != nil {
+		return err
+	}
+	path = filepath.Join(src.Dir, filepath.FromSlash(path))
+	stack = append(stack, name)
+	for _, parent := range f.Extends {
+		if err := r.resolve(parent, stack); err != nil {
+			return err
+		}
+	}
+	r.done[name] = true
+	r.files = append(r.files, loadedFile{name: name, path: path, file: f})
+	return nil
+}
+
+// notFound builds the error for an unknown profile
+func (r *resolver) notFound(name string) error {
+	available, err := available(r.sources)
+	if err != nil {
+		return err
+	}
+	if len(available) == 0 {
+		dirs := make([]string, len(r.sources))
+		for i, src := range r.sources {
+			dirs[i] = src.Dir
+		}
+		return fmt.Errorf("profile %q not found: no profiles in %s", name, strings.Join(dirs, ", "))
+	}
+	return fmt.Errorf("profile %q not found; available profiles: %s", name, strings.Join(available, ", "))
+}
+
+// merge applies the settings of overlay on top of dst
+func merge(dst *file, overlay file) {
+	if overlay.Values != nil {
+		dst.Values = values.Merge(dst.Values, overlay.Values)
+	}
+	if overlay.Release.Name != "" {
+		dst.Release.Name = overlay.Release.Name
+	}
+	if overlay.Release.Namespace != "" {
+		dst.Release.Namespace = overlay.Release.Namespace
+	}
+	if overlay.Release.Revision != 0 {
+		dst.Release.Revision = overlay.Release.Revision
+	}
+	if overlay.Release.Upgrade != nil {
+		dst.Release.Upgrade = overlay.Release.Upgrade
+	}
+	if overlay.Release.Service != "" {
+		dst.Release.Service = overlay.Release.Service
+	}
+	if overlay.Capabilities.KubeVersion != "" {
+		dst.Capabilities.KubeVersion = overlay.Capabilities.KubeVersion
+	}
+	if overlay.Capabilities.APIVersions != nil {
+		dst.Capabilities.APIVersions = overlay.Capabilities.APIVersions
+	}
+}
+
+func (f file) capabilities() types.Capabilities {
+	return types.Capabilities{
+		KubeVersion: f.Capabilities.KubeVersion,
+		APIVersions: f.Capabilities.APIVersions,
+	}
+}
+
+func (f file) release() types.Release {
+	return types.Release{
+		Name:      f.Release.Name,
+		Namespace: f.Release.Namespace,
+		Revision:  f.Release.Revision,
+		IsUpgrade: f.Release.Upgrade,
+		Service:   f.Release.Service,
+	}
+}
+
+// available returns the sorted names of the profiles in the sources.
+// Missing directories are skipped.
+func available(sources []Source) ([]string, error) {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, src := range sources {
+		entries, err := fs.ReadDir(src.FS, ".")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			for _, ext := range extensions {
+				if name, ok := strings.CutSuffix(e.Name(), ext); ok && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// find returns the source that has the profile file and the file's path in
+// it, or an empty path when no source has one
+func find(name string, sources []Source) (Source, string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return Source{}, "", fmt.Errorf("invalid profile name %q", name)
+	}
+	for _, src := range sources {
+		for _, ext := range extensions {
+			path := name + ext
+			info, err := fs.Stat(src.FS, path)
+			if err == nil && !info.IsDir() {
+				return src, path, nil
+			}
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return Source{}, "", err
+			}
+		}
+	}
+	return Source{}, "", nil
+}
+
+// read parses a profile file. Unknown keys are rejected so typos don't go
+// unnoticed.
+func read(src Source, path string) (file, error) {
+	var f file
+	content, err := fs.ReadFile(src.FS, path)
+	if err != nil {
+		return f, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return f, fmt.Errorf("profile %s: %v", filepath.Join(src.Dir, filepath.FromSlash(path)), err)
+	}
+	return f, nil
+}
@@ -0,0 +1,305 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"helmish/internal/renderer/types"
+)
+
+func writeProfiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	chartDir := writeProfiles(t, map[string]string{
+		"staging.yaml": `values:
+  replicaCount: 2
+  image:
+    tag: rc
+release:
+  name: web
+  namespace: staging
+  revision: 3
+  upgrade: true
+capabilities:
+  kubeVersion: "1.28"
+  apiVersions: [v1, policy/v1]
+`,
+		"prod.yml":    "release:\n  namespace: prod\n",
+		"shared.yaml": "release:\n  namespace: chart\n",
+		"typo.yaml":   "relase:\n  name: x\n",
+		"empty.yaml":  "",
+	})
+	userDir := writeProfiles(t, map[string]string{
+		"shared.yaml": "release:\n  namespace: user\n",
+	})
+
+	tests := []struct {
+		name     string
+		profile  string
+		dirs     []string
+		expected types.Profile
+		chain    []string // defaults to just the profile itself
+		wantErr  string
+	}{
+		{
+			name:    "full profile",
+			profile: "staging",
+			dirs:    []string{chartDir},
+			expected: types.Profile{
+				Name:         "staging",
+				Capabilities: types.Capabilities{KubeVersion: "1.28", APIVersions: []string{"v1", "policy/v1"}},
+				Release:      types.Release{Name: "web", Namespace: "staging", Revision: 3, IsUpgrade: boolPtr(true)},
+				Values:       map[string]interface{}{"replicaCount": 2, "image": map[string]interface{}{"tag": "rc"}},
+			},
+		},
+		{
+			name:     "yml extension",
+			profile:  "prod",
+			dirs:     []string{chartDir},
+			expected: types.Profile{Name: "prod", Release: types.Release{Namespace: "prod"}},
+		},
+		{
+			name:     "earlier directories win",
+			profile:  "shared",
+			dirs:     []string{userDir, chartDir},
+			expected: types.Profile{Name: "shared", Release: types.Release{Namespace: "user"}},
+		},
+		{
+			name:     "empty file",
+			profile:  "empty",
+			dirs:     []string{chartDir},
+			expected: types.Profile{Name: "empty"},
+		},
+		{
+			name:     "default needs no file",
+			profile:  "",
+			dirs:     []string{chartDir, filepath.Join(chartDir, "missing")},
+			expected: types.Profile{Name: "default"},
+		},
+		{
+			name:    "unknown profile lists the available ones",
+			profile: "qa",
+			dirs:    []string{userDir, chartDir},
+			wantErr: `profile "qa" not found; available profiles: empty, prod, shared, staging, typo`,
+		},
+		{
+			name:    "unknown profile without any profiles",
+			profile: "qa",
+			dirs:    []string{filepath.Join(chartDir, "missing")},
+			wantErr: `profile "qa" not found: no profiles in`,
+		},
+		{
+			name:    "unknown keys are rejected",
+			profile: "typo",
+			dirs:    []string{chartDir},
+			wantErr: "field relase not found",
+		},
+		{
+			name:    "path in name",
+			profile: "../staging",
+			dirs:    []string{chartDir},
+			wantErr: "invalid profile name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.profile, tt.dirs...)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var chain []string
+			for _, layer := range got.Chain {
+				chain = append(chain, layer.Name)
+			}
+			if tt.chain == nil && len(chain) > 0 {
+				tt.chain = []string{tt.expected.Name}
+			}
+			if !reflect.DeepEqual(chain, tt.chain) {
+				t.Errorf("expected chain %v, got %v", tt.chain, chain)
+			}
+			got.Chain = nil
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoad_Extends(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base.yaml": `values:
+  replicas: 1
+  image:
+    repo: nginx
+    tag: stable
+  args: [a, b]
+release:
+  namespace: base
+  upgrade: true
+capabilities:
+  kubeVersion: "1.25"
+  apiVersions: [v1]
+`,
+		"staging.yaml": `extends: [base]
+values:
+  replicas: 2
+  image:
+    tag: rc
+release:
+  namespace: staging
+`,
+		"eu-common.yaml": `extends: [base]
+values:
+  region: eu
+  args: [eu]
+capabilities:
+  apiVersions: [v1, policy/v1]
+`,
+		"staging-eu.yaml": `extends: [staging, eu-common]
+release:
+  name: web-eu
+  upgrade: false
+`,
+		"a.yaml":      "extends: [b]\n",
+		"b.yaml":      "extends: [c]\n",
+		"c.yaml":      "extends: [a]\n",
+		"self.yaml":   "extends: [self]\n",
+		"orphan.yaml": "extends: [missing]\n",
+	})
+
+	tests := []struct {
+		name     string
+		profile  string
+		expected types.Profile
+		chain    []string
+		wantErr  string
+	}{
+		{
+			name:    "single parent",
+			profile: "staging",
+			expected: types.Profile{
+				Name:         "staging",
+				Capabilities: types.Capabilities{KubeVersion: "1.25", APIVersions: []string{"v1"}},
+				Release:      types.Release{Namespace: "staging", IsUpgrade: boolPtr(true)},
+				Values: map[string]interface{}{
+					"replicas": 2,
+					"image":    map[string]interface{}{"repo": "nginx", "tag": "rc"},
+					"args":     []interface{}{"a", "b"},
+				},
+			},
+			chain: []string{"base", "staging"},
+		},
+		{
+			name:    "parents merge in order and a shared base is included once",
+			profile: "staging-eu",
+			expected: types.Profile{
+				Name:         "staging-eu",
+				Capabilities: types.Capabilities{KubeVersion: "1.25", APIVersions: []string{"v1", "policy/v1"}},
+				Release:      types.Release{Name: "web-eu", Namespace: "staging", IsUpgrade: boolPtr(false)},
+				Values: map[string]interface{}{
+					"replicas": 2,
+					"image":    map[string]interface{}{"repo": "nginx", "tag": "rc"},
+					"args":     []interface{}{"eu"},
+					"region":   "eu",
+				},
+			},
+			chain: []string{"base", "staging", "eu-common", "staging-eu"},
+		},
+		{
+			name:    "cycle",
+			profile: "a",
+			wantErr: "profile cycle: a -> b -> c -> a",
+		},
+		{
+			name:    "profile extending itself",
+			profile: "self",
+			wantErr: "profile cycle: self -> self",
+		},
+		{
+			name:    "unknown parent",
+			profile: "orphan",
+			wantErr: `profile "orphan" extends profile "missing" not found; available profiles:`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.profile, dir)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var chain []string
+			for _, layer := range got.Chain {
+				chain = append(chain, layer.Name)
+			}
+			if !reflect.DeepEqual(chain, tt.chain) {
+				t.Errorf("expected chain %v, got %v", tt.chain, chain)
+			}
+			got.Chain = nil
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoad_ChainLayers(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base.yaml":    "values:\n  a: 1\nrelease:\n  namespace: base\n",
+		"staging.yaml": "extends: [base]\nvalues:\n  b: 2\n",
+	})
+	got, err := Load("staging", dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []types.ProfileLayer{
+		{
+			Name:    "base",
+			Path:    filepath.Join(dir, "base.yaml"),
+			Release: types.Release{Namespace: "base"},
+			Values:  map[string]interface{}{"a": 1},
+		},
+		{
+			Name:    "staging",
+			Path:    filepath.Join(dir, "staging.yaml"),
+			Extends: []string{"base"},
+			Values:  map[string]interface{}{"b": 2},
+		},
+	}
+	if !reflect.DeepEqual(got.Chain, expected) {
+		t.Errorf("expected chain %+v, got %+v", expected, got.Chain)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
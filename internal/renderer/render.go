@@ -1,17 +1,23 @@
 package renderer
 
 import (
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"helmish/internal/renderer/ast"
 	"helmish/internal/renderer/eval"
-	"helmish/internal/renderer/parser"
+	"helmish/internal/renderer/schema"
 	"helmish/internal/renderer/tokenizer"
 	"helmish/internal/renderer/types"
+	helmvalues "helmish/internal/renderer/values"
+	"helmish/pkg/strvals"
 )
 
 // Aliases for public API
@@ -19,109 +25,446 @@ type ValueData = types.ValueData
 type Chart = types.Chart
 type Profile = types.Profile
 type Capabilities = types.Capabilities
+type Release = types.Release
+type ProfileLayer = types.ProfileLayer
+type ValueFile = types.ValueFile
 type Options = types.Options
+type Dependency = types.Dependency
 
-// LoadChart loads the chart from the given path
-func LoadChart(path string) (types.Chart, error) {
-	chart := types.Chart{
-		Path:          path,
-		Values:        make(types.Values),
-		Metadata:      make(types.Metadata),
-		YamlTemplates: make(types.YamlTemplates),
-		TplFiles:      make(types.TplFiles),
+// DefaultValuesFile is the name of the chart's default values file
+const DefaultValuesFile = "values.yaml"
+
+// NotesFile is the name of the template in templates/ holding the usage
+// notes of a chart
+const NotesFile = "NOTES.txt"
+
+// Rendered is the output of a render
+type Rendered struct {
+	Files map[string][][]types.Token // the documents of each template file
+	CRDs  map[string][][]types.Token // the documents of each crds/ file, e.g. charts/redis/crds/x.yaml
+	Notes []types.Token              // the rendered NOTES.txt of the top-level chart, nil if it has none
+}
+
+// LoadValuesFile loads a user supplied values file. An empty file holds no
+// values; anything else must be a YAML mapping.
+func LoadValuesFile(path string) (types.ValueFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return types.ValueFile{}, err
+	}
+	parsed := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return types.ValueFile{}, fmt.Errorf("values file %s: %v", path, err)
+	}
+	return types.ValueFile{
+		Path:      path,
+		ValueData: types.ValueData{Raw: string(content), Parsed: parsed},
+	}, nil
+}
+
+// userValues layers the profile values, the values files and the --set
+// values, in that order. It also returns the --set values on their own.
+func userValues(opts Options) (user, set map[string]interface{}, err error) {
+	user = opts.Profile.Values
+	for _, f := range opts.ValuesFiles {
+		layer, _ := f.Parsed.(map[string]interface{})
+		user = helmvalues.Merge(user, layer)
+	}
+	if set, err = setValues(opts); err != nil {
+		return nil, nil, err
+	}
+	if len(set) > 0 {
+		user = helmvalues.Merge(user, set)
 	}
+	return user, set, nil
+}
 
-	// Load Chart.yaml for metadata
-	chartYamlPath := filepath.Join(path, "Chart.yaml")
-	if content, err := os.ReadFile(chartYamlPath); err == nil {
-		var parsed interface{}
-		if err := yaml.Unmarshal(content, &parsed); err != nil {
-			return chart, err
+// setValues parses the --set style expressions of opts into one layer of
+// values. Like helm, --set-json is applied first, then --set, --set-string
+// and --set-file, each in the order given.
+func setValues(opts Options) (map[string]interface{}, error) {
+	set := map[string]interface{}{}
+	for _, expr := range opts.SetJSON {
+		if err := strvals.ParseJSON(expr, set); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-json data %s: %v", expr, err)
+		}
+	}
+	for _, expr := range opts.Set {
+		if err := strvals.ParseInto(expr, set); err != nil {
+			return nil, fmt.Errorf("failed parsing --set data %s: %v", expr, err)
 		}
-		chart.Metadata["Chart.yaml"] = types.ValueData{
-			Raw:    string(content),
-			Parsed: normalizeChartMetadata(parsed),
+	}
+	for _, expr := range opts.SetString {
+		if err := strvals.ParseIntoString(expr, set); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-string data %s: %v", expr, err)
+		}
+	}
+	readFile := func(rs []rune) (interface{}, error) {
+		content, err := os.ReadFile(string(rs))
+		return string(content), err
+	}
+	for _, expr := range opts.SetFile {
+		if err := strvals.ParseIntoFile(expr, set, readFile); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-file data %s: %v", expr, err)
+		}
+	}
+	return set, nil
+}
+
+// valuesLayer is one source of values, e.g. a profile or a values file
+type valuesLayer struct {
+	source string
+	values map[string]interface{}
+}
+
+// valuesLayers lists the sources of the values of a render, in increasing
+// precedence
+func valuesLayers(opts Options, set map[string]interface{}) []valuesLayer {
+	var layers []valuesLayer
+	if val, ok := opts.Chart.Values[DefaultValuesFile]; ok {
+		defaults, _ := val.Parsed.(map[string]interface{})
+		layers = append(layers, valuesLayer{source: "chart " + DefaultValuesFile, values: defaults})
+	}
+	if len(opts.Profile.Chain) == 0 {
+		layers = append(layers, valuesLayer{source: fmt.Sprintf("profile %q", opts.Profile.Name), values: opts.Profile.Values})
+	}
+	for _, l := range opts.Profile.Chain {
+		layers = append(layers, valuesLayer{source: fmt.Sprintf("profile %q (%s)", l.Name, l.Path), values: l.Values})
+	}
+	for _, f := range opts.ValuesFiles {
+		parsed, _ := f.Parsed.(map[string]interface{})
+		layers = append(layers, valuesLayer{source: "values file " + f.Path, values: parsed})
+	}
+	layers = append(layers, valuesLayer{source: "--set", values: set})
+	return layers
+}
+
+// validateValues checks the values of a chart against its schema. Every
+// violation names the layer that supplied the offending value, and its path
+// is relative to the top-level values.
+func validateValues(c scopedChart) ([]schema.Violation, error) {
+	if c.chart.Schema == nil {
+		return nil, nil
+	}
+	s, err := schema.Parse(c.chart.Schema)
+	if err != nil {
+		if c.prefix != "" {
+			err = fmt.Errorf("%s/%w", c.prefix, err)
 		}
-	} else {
-		return chart, err
+		return nil, err
+	}
+	violations := s.Validate(c.values)
+	for i := range violations {
+		violations[i].Source = sourceOf(c.layers, violations[i].Path)
+		violations[i].Path = c.pointer + violations[i].Path
 	}
+	return violations, nil
+}
 
-	// Load values.yaml for values
-	valuesYamlPath := filepath.Join(path, "values.yaml")
-	if content, err := os.ReadFile(valuesYamlPath); err == nil {
-		var parsed interface{}
-		if err := yaml.Unmarshal(content, &parsed); err != nil {
-			return chart, err
+// sourceOf returns the source of the layer with the highest precedence that
+// sets the value at the JSON pointer, or of its closest parent. It returns
+// an empty string when no layer sets any of them.
+func sourceOf(layers []valuesLayer, pointer string) string {
+	tokens := strings.Split(pointer, "/")[1:]
+	for i := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(tokens[i], "~1", "/"), "~0", "~")
+	}
+	for n := len(tokens); n > 0; n-- {
+		for i := len(layers) - 1; i >= 0; i-- {
+			if hasPath(layers[i].values, tokens[:n]) {
+				return layers[i].source
+			}
 		}
-		chart.Values["values.yaml"] = types.ValueData{
-			Raw:    string(content),
-			Parsed: parsed,
+	}
+	return ""
+}
+
+// hasPath reports whether the values set the path, possibly to null
+func hasPath(values map[string]interface{}, path []string) bool {
+	var cur interface{} = values
+	for _, key := range path {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return false
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return false
+			}
+			cur = node[i]
+		default:
+			return false
 		}
-	} else {
-		return chart, err
 	}
+	return true
+}
+
+// RenderChart renders the Helm chart using the TUI. Like helm, only the
+// NOTES.txt of the top-level chart is rendered, the crds/ files are emitted
+// as they are and library charts only contribute named templates. A
+// library chart cannot be rendered on its own.
+func RenderChart(opts Options) (Rendered, error) {
+	if isLibrary(chartMetadata(opts.Chart)) {
+		return Rendered{}, fmt.Errorf("library charts are not installable")
+	}
+	result := Rendered{Files: make(map[string][][]types.Token), CRDs: make(map[string][][]types.Token)}
+	user, set, err := userValues(opts)
+	if err != nil {
+		return Rendered{}, err
+	}
+	// The subcharts disabled by the values are dropped before the values
+	// are coalesced for rendering, so their defaults don't show up
+	tree, _, err := resolveDependencies(opts.Chart, user)
+	if err != nil {
+		return Rendered{}, err
+	}
+	// Coalesce shares nested maps with its inputs, and templates may modify
+	// the values with set, so they work on a copy of the loaded chart's
+	// defaults and the user values.
+	values := helmvalues.Coalesce(helmvalues.Copy(tree.defaults()), helmvalues.Copy(user))
+	charts := scopeCharts(tree, "", values, valuesLayers(opts, set))
 
-	// Load templates
-	templatesPath := filepath.Join(path, "templates")
-	err := filepath.Walk(templatesPath, func(p string, info os.FileInfo, err error) error {
+	var violations []schema.Violation
+	for _, c := range charts {
+		v, err := validateValues(c)
 		if err != nil {
-			return err
+			return Rendered{}, err
 		}
-		if info.IsDir() {
-			return nil
+		violations = append(violations, v...)
+	}
+	if len(violations) > 0 {
+		return Rendered{}, &schema.ValidationError{Violations: violations}
+	}
+
+	ctx := eval.NewEvalContext(values, nil)
+	capabilities, err := eval.NewCapabilities(opts.Profile.Capabilities)
+	if err != nil {
+		return Rendered{}, err
+	}
+	release := releaseObject(opts.Profile.Release)
+	topName := chartName(chartMetadata(opts.Chart))
+
+	// Named templates may be defined in .tpl files or in any YAML template
+	// of any chart, so everything is parsed before the first template is
+	// evaluated. Like helm, subcharts are parsed first so the parent's
+	// definitions win.
+	files := make(map[string][]ast.Node)
+	for i := len(charts) - 1; i >= 0; i-- {
+		c := charts[i]
+		for _, filename := range sortedKeys(c.chart.TplFiles) {
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(c.chart.TplFiles[filename]))
+			if err != nil {
+				return Rendered{}, fmt.Errorf("%s: %w", c.outputPath(filename), err)
+			}
+			eval.CollectTemplates(nodes, ctx.Templates)
 		}
-		relPath, _ := filepath.Rel(templatesPath, p)
-		content, err := os.ReadFile(p)
+		// Each template file is parsed as a whole, so blocks may span the
+		// --- separators between its documents
+		for _, filename := range sortedKeys(c.chart.YamlTemplates) {
+			nodes, err := ast.ParseAST(tokens.TokenizeSource(c.chart.YamlTemplates[filename]))
+			if err != nil {
+				return Rendered{}, fmt.Errorf("%s: %w", c.outputPath(filename), err)
+			}
+			eval.CollectTemplates(nodes, ctx.Templates)
+			files[c.outputPath(filename)] = nodes
+		}
+	}
+	var notes []ast.Node
+	if top := opts.Chart; top.Notes != "" {
+		notes, err = ast.ParseAST(tokens.TokenizeSource(top.Notes))
 		if err != nil {
-			return err
+			return Rendered{}, fmt.Errorf("%s: %w", NotesFile, err)
+		}
+		eval.CollectTemplates(notes, ctx.Templates)
+	}
+
+	for _, c := range charts {
+		if isLibrary(c.metadata) {
+			continue
 		}
-		ext := filepath.Ext(p)
-		switch ext {
-		case ".yaml", ".yml":
-			chart.YamlTemplates[relPath] = string(content)
-		case ".tpl":
-			chart.TplFiles[relPath] = string(content)
+		if !opts.SkipCRDs {
+			for _, filename := range sortedKeys(c.chart.CRDs) {
+				crd := types.Token{Type: types.TokenText, Value: string(c.chart.CRDs[filename]), Line: 1}
+				result.CRDs[path.Join(c.prefix, "crds", filename)] = splitDocuments([]types.Token{crd})
+			}
+		}
+		root := types.NewRoot(c.values, c.metadata)
+		root["Release"] = release
+		root["Capabilities"] = capabilities
+		root["Files"] = eval.Files(c.chart.Files)
+		basePath := path.Join(topName, c.prefix, "templates")
+		for _, filename := range sortedKeys(c.chart.YamlTemplates) {
+			name := c.outputPath(filename)
+			fileCtx := ctx.WithRoot(withTemplate(root, basePath, filename))
+			evaluatedTokens, err := eval.EvaluateAST(files[name], fileCtx)
+			if err != nil {
+				return Rendered{}, fmt.Errorf("%s: %w", name, err)
+			}
+			result.Files[name] = splitDocuments(evaluatedTokens)
+		}
+		if c.prefix == "" && notes != nil {
+			fileCtx := ctx.WithRoot(withTemplate(root, basePath, NotesFile))
+			result.Notes, err = eval.EvaluateAST(notes, fileCtx)
+			if err != nil {
+				return Rendered{}, fmt.Errorf("%s: %w", NotesFile, err)
+			}
 		}
-		return nil
-	})
-	if err != nil {
-		// Return error if templates directory doesn't exist or any read error
-		return chart, err
 	}
+	return result, nil
+}
 
-	return chart, nil
+// chartMetadata returns the normalized Chart.yaml of a chart
+func chartMetadata(chart types.Chart) interface{} {
+	if meta, ok := chart.Metadata["Chart.yaml"]; ok {
+		return meta.Parsed
+	}
+	return nil
 }
 
-// RenderChart renders the Helm chart using the TUI
-func RenderChart(opts Options) (map[string][][]types.Token, error) {
-	result := make(map[string][][]types.Token)
-	// Create eval context from values and chart
-	var values, chart interface{}
-	if val, ok := opts.Chart.Values["values.yaml"]; ok {
-		values = val.Parsed
+// releaseObject builds the .Release member from the profile, filling in the
+// defaults helm template uses for anything left empty
+func releaseObject(r types.Release) map[string]interface{} {
+	if r.Name == "" {
+		r.Name = "release-name"
 	}
-	if meta, ok := opts.Chart.Metadata["Chart.yaml"]; ok {
-		chart = meta.Parsed
+	if r.Namespace == "" {
+		r.Namespace = "default"
 	}
-	ctx := eval.NewEvalContext(values, chart)
-	for filename, content := range opts.Chart.YamlTemplates {
-		blocks := parser.CollectBlocks(content)
-		for _, doc := range blocks {
-			tokens := tokens.Tokenize(doc)
-			// Parse AST from tokens
-			nodes, err := ast.ParseAST(tokens)
-			if err != nil {
-				return nil, err
+	if r.Revision == 0 {
+		r.Revision = 1
+	}
+	if r.Service == "" {
+		r.Service = "Helm"
+	}
+	isUpgrade := r.IsUpgrade != nil && *r.IsUpgrade
+	return map[string]interface{}{
+		"Name":      r.Name,
+		"Namespace": r.Namespace,
+		"Revision":  r.Revision,
+		"IsInstall": !isUpgrade,
+		"IsUpgrade": isUpgrade,
+		"Service":   r.Service,
+	}
+}
+
+// withTemplate returns a copy of the root object whose Template member
+// describes the template file being rendered
+func withTemplate(root map[string]interface{}, basePath, filename string) map[string]interface{} {
+	fileRoot := make(map[string]interface{}, len(root))
+	for k, v := range root {
+		fileRoot[k] = v
+	}
+	fileRoot["Template"] = map[string]interface{}{
+		"Name":     path.Join(basePath, filepath.ToSlash(filename)),
+		"BasePath": basePath,
+	}
+	return fileRoot
+}
+
+// chartName returns the name from the normalized chart metadata
+func chartName(chart interface{}) string {
+	if m, ok := chart.(map[string]interface{}); ok {
+		if name, ok := m["Name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// isLibrary reports whether the normalized chart metadata is the one of a
+// library chart
+func isLibrary(chart interface{}) bool {
+	m, ok := chart.(map[string]interface{})
+	return ok && m["Type"] == "library"
+}
+
+// splitDocuments splits rendered tokens into YAML documents at lines that
+// consist of a --- separator. Like Helm, surrounding whitespace is trimmed
+// from each document and documents holding only whitespace are dropped.
+func splitDocuments(rendered []types.Token) [][]types.Token {
+	var docs [][]types.Token
+	var current []types.Token
+	flush := func() {
+		if trimDocument(current) {
+			docs = append(docs, current)
+		}
+		current = nil
+	}
+	atLineStart := true
+	for _, tok := range rendered {
+		if tok.Type != types.TokenText {
+			current = append(current, tok)
+			if tok.Value != "" {
+				atLineStart = strings.HasSuffix(tok.Value, "\n")
 			}
-			// Evaluate the AST
-			evaluatedTokens, err := eval.EvaluateAST(nodes, ctx)
-			if err != nil {
-				return nil, err
+			continue
+		}
+		var sb strings.Builder
+		rest := tok.Value
+		for rest != "" {
+			line := rest
+			if i := strings.IndexByte(rest, '\n'); i >= 0 {
+				line = rest[:i+1]
 			}
-			result[filename] = append(result[filename], evaluatedTokens)
+			rest = rest[len(line):]
+			if atLineStart && strings.TrimSpace(line) == "---" {
+				if sb.Len() > 0 {
+					piece := tok
+					piece.Value = sb.String()
+					current = append(current, piece)
+					sb.Reset()
+				}
+				flush()
+				continue
+			}
+			sb.WriteString(line)
+			atLineStart = strings.HasSuffix(line, "\n")
+		}
+		if sb.Len() > 0 || tok.Value == "" {
+			piece := tok
+			piece.Value = sb.String()
+			current = append(current, piece)
 		}
 	}
-	return result, nil
+	flush()
+	return docs
+}
+
+// trimDocument trims leading and trailing whitespace from the tokens of a
+// document in place. It reports whether anything but whitespace is left.
+func trimDocument(doc []types.Token) bool {
+	first := -1
+	for i := range doc {
+		doc[i].Value = strings.TrimLeft(doc[i].Value, " \t\r\n")
+		if doc[i].Value != "" {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return false
+	}
+	for i := len(doc) - 1; i >= first; i-- {
+		doc[i].Value = strings.TrimRight(doc[i].Value, " \t\r\n")
+		if doc[i].Value != "" {
+			break
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of a file map in sorted order
+func sortedKeys[V any](files map[string]V) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // normalizeChartMetadata converts map keys from YAML (lowercase) to Helm casing (Title)
@@ -0,0 +1,597 @@
+// Package schema validates chart values against the JSON Schema of a
+// chart's values.schema.json, like Helm does before rendering.
+//
+// It implements the validation keywords of JSON Schema draft 7 that charts
+// use: type, enum, const, the numeric, string, array and object keywords,
+// allOf, anyOf, oneOf, not, if/then/else and $ref to definitions inside the
+// same schema. format is an annotation only and is not checked.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// File is the name of the schema file in a chart
+const File = "values.schema.json"
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Violation is a value that does not meet the schema
+type Violation struct {
+	Path    string // JSON pointer to the offending value, "" for the root
+	Message string
+	Source  string // where the value came from, if known
+}
+
+// String formats the violation as "path: message (from source)"
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "(root)"
+	}
+	s := path + ": " + v.Message
+	if v.Source != "" {
+		s += " (from " + v.Source + ")"
+	}
+	return s
+}
+
+// ValidationError reports every violation found in a set of values
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("values don't meet the specifications of the schema in " + File + ":")
+	for _, v := range e.Violations {
+		sb.WriteString("\n- " + v.String())
+	}
+	return sb.String()
+}
+
+// Parse parses the content of a schema file
+func Parse(content []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("%s: %v", File, err)
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", File)
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, fmt.Errorf("%s: %v", File, err)
+	}
+	return s, nil
+}
+
+// compilePatterns compiles the regular expressions of the schema up front,
+// so an invalid one is reported once instead of for every value
+func (s *Schema) compilePatterns(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if p, ok := v.(string); ok && k == "pattern" {
+				if err := s.compile(p); err != nil {
+					return err
+				}
+			}
+			if props, ok := v.(map[string]interface{}); ok && k == "patternProperties" {
+				for p := range props {
+					if err := s.compile(p); err != nil {
+						return err
+					}
+				}
+			}
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compile(pattern string) error {
+	if _, ok := s.patterns[pattern]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	s.patterns[pattern] = re
+	return nil
+}
+
+// Validate checks the values against the schema and returns every violation,
+// ordered by path
+func (s *Schema) Validate(values interface{}) []Violation {
+	var out []Violation
+	s.validate(s.root, values, "", nil, &out)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// validate checks value, found at path, against the schema node and appends
+// the violations to out. refs holds the $refs being followed for this value;
+// meeting one again would loop forever without consuming any input.
+func (s *Schema) validate(node, value interface{}, path string, refs map[string]bool, out *[]Violation) {
+	report := func(format string, args ...interface{}) {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	var sch map[string]interface{}
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			report("no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		sch = n
+	default:
+		return
+	}
+
+	if ref, ok := sch["$ref"].(string); ok {
+		if refs[ref] {
+			report("circular $ref %q", ref)
+			return
+		}
+		target, err := s.resolve(ref)
+		if err != nil {
+			report("%v", err)
+			return
+		}
+		if refs == nil {
+			refs = make(map[string]bool)
+		}
+		refs[ref] = true
+		s.validate(target, value, path, refs, out)
+		delete(refs, ref)
+	}
+
+	value = normalize(value)
+	if t, ok := sch["type"]; ok && !typeMatches(t, value) {
+		report("expected %s, got %s", typeList(t), typeOf(value))
+		// The remaining keywords would only repeat the mismatch
+		return
+	}
+	if enum, ok := sch["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("must be one of %s", jsonList(enum))
+		}
+	}
+	if c, ok := sch["const"]; ok && !equal(c, value) {
+		report("must be %s", toJSON(c))
+	}
+
+	switch v := value.(type) {
+	case float64:
+		s.validateNumber(sch, v, report)
+	case string:
+		s.validateString(sch, v, report)
+	case []interface{}:
+		s.validateArray(sch, v, path, out, report)
+	case map[string]interface{}:
+		s.validateObject(sch, v, path, refs, out, report)
+	}
+
+	if all, ok := sch["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, refs, out)
+		}
+	}
+	if anyOf, ok := sch["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if s.valid(sub, value, refs) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("must match at least one schema of anyOf")
+		}
+	}
+	if oneOf, ok := sch["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if s.valid(sub, value, refs) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			report("must match exactly one schema of oneOf, matched %d", matched)
+		}
+	}
+	if not, ok := sch["not"]; ok && s.valid(not, value, refs) {
+		report("must not match the schema of not")
+	}
+	if cond, ok := sch["if"]; ok {
+		if s.valid(cond, value, refs) {
+			if then, ok := sch["then"]; ok {
+				s.validate(then, value, path, refs, out)
+			}
+		} else if els, ok := sch["else"]; ok {
+			s.validate(els, value, path, refs, out)
+		}
+	}
+}
+
+// valid reports whether value meets the schema node
+func (s *Schema) valid(node, value interface{}, refs map[string]bool) bool {
+	var out []Violation
+	s.validate(node, value, "", refs, &out)
+	return len(out) == 0
+}
+
+func (s *Schema) validateNumber(sch map[string]interface{}, v float64, report func(string, ...interface{})) {
+	if min, ok := number(sch["minimum"]); ok {
+		if excl, _ := sch["exclusiveMinimum"].(bool); excl && v <= min {
+			report("must be greater than %s", formatNumber(min))
+		} else if v < min {
+			report("must be greater than or equal to %s", formatNumber(min))
+		}
+	}
+	if max, ok := number(sch["maximum"]); ok {
+		if excl, _ := sch["exclusiveMaximum"].(bool); excl && v >= max {
+			report("must be less than %s", formatNumber(max))
+		} else if v > max {
+			report("must be less than or equal to %s", formatNumber(max))
+		}
+	}
+	if min, ok := number(sch["exclusiveMinimum"]); ok && v <= min {
+		report("must be greater than %s", formatNumber(min))
+	}
+	if max, ok := number(sch["exclusiveMaximum"]); ok && v >= max {
+		report("must be less than %s", formatNumber(max))
+	}
+	if m, ok := number(sch["multipleOf"]); ok && m > 0 {
+		if q := v / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			report("must be a multiple of %s", formatNumber(m))
+		}
+	}
+}
+
+func (s *Schema) validateString(sch map[string]interface{}, v string, report func(string, ...interface{})) {
+	length := utf8.RuneCountInString(v)
+	if min, ok := number(sch["minLength"]); ok && float64(length) < min {
+		report("length must be at least %s", formatNumber(min))
+	}
+	if max, ok := number(sch["maxLength"]); ok && float64(length) > max {
+		report("length must be at most %s", formatNumber(max))
+	}
+	if p, ok := sch["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+		report("must match pattern %q", p)
+	}
+}
+
+func (s *Schema) validateArray(sch map[string]interface{}, v []interface{}, path string, out *[]Violation, report func(string, ...interface{})) {
+	if min, ok := number(sch["minItems"]); ok && float64(len(v)) < min {
+		report("must have at least %s items", formatNumber(min))
+	}
+	if max, ok := number(sch["maxItems"]); ok && float64(len(v)) > max {
+		report("must have at most %s items", formatNumber(max))
+	}
+	if unique, _ := sch["uniqueItems"].(bool); unique {
+	outer:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if equal(v[i], v[j]) {
+					report("items %d and %d are equal", j, i)
+					break outer
+				}
+			}
+		}
+	}
+	switch items := sch["items"].(type) {
+	case []interface{}:
+		// Tuple validation: one schema per position, then additionalItems
+		for i, item := range v {
+			if i < len(items) {
+				s.validate(items[i], item, pointer(path, strconv.Itoa(i)), nil, out)
+			} else if additional, ok := sch["additionalItems"]; ok {
+				s.validate(additional, item, pointer(path, strconv.Itoa(i)), nil, out)
+			}
+		}
+	case map[string]interface{}, bool:
+		for i, item := range v {
+			s.validate(items, item, pointer(path, strconv.Itoa(i)), nil, out)
+		}
+	}
+	if contains, ok := sch["contains"]; ok {
+		found := false
+		for _, item := range v {
+			if s.valid(contains, item, nil) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("must contain an item matching the schema of contains")
+		}
+	}
+}
+
+func (s *Schema) validateObject(sch map[string]interface{}, v map[string]interface{}, path string, refs map[string]bool, out *[]Violation, report func(string, ...interface{})) {
+	if min, ok := number(sch["minProperties"]); ok && float64(len(v)) < min {
+		report("must have at least %s properties", formatNumber(min))
+	}
+	if max, ok := number(sch["maxProperties"]); ok && float64(len(v)) > max {
+		report("must have at most %s properties", formatNumber(max))
+	}
+	if required, ok := sch["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := v[name]; !ok {
+				*out = append(*out, Violation{Path: pointer(path, name), Message: "is required"})
+			}
+		}
+	}
+	props, _ := sch["properties"].(map[string]interface{})
+	patternProps, _ := sch["patternProperties"].(map[string]interface{})
+	for _, name := range sortedKeys(v) {
+		item := v[name]
+		itemPath := pointer(path, name)
+		if names, ok := sch["propertyNames"]; ok && !s.valid(names, name, nil) {
+			*out = append(*out, Violation{Path: itemPath, Message: "property name does not match the schema of propertyNames"})
+		}
+		matched := false
+		if p, ok := props[name]; ok {
+			matched = true
+			s.validate(p, item, itemPath, nil, out)
+		}
+		for _, pattern := range sortedKeys(patternProps) {
+			if s.patterns[pattern].MatchString(name) {
+				matched = true
+				s.validate(patternProps[pattern], item, itemPath, nil, out)
+			}
+		}
+		if matched {
+			continue
+		}
+		switch additional := sch["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*out = append(*out, Violation{Path: itemPath, Message: "additional property is not allowed"})
+			}
+		case map[string]interface{}:
+			s.validate(additional, item, itemPath, nil, out)
+		}
+	}
+	if deps, ok := sch["dependencies"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(deps) {
+			if _, present := v[name]; !present {
+				continue
+			}
+			switch dep := deps[name].(type) {
+			case []interface{}:
+				for _, r := range dep {
+					other, _ := r.(string)
+					if _, ok := v[other]; !ok {
+						*out = append(*out, Violation{Path: pointer(path, other), Message: fmt.Sprintf("is required when %s is set", name)})
+					}
+				}
+			default:
+				s.validate(dep, v, path, refs, out)
+			}
+		}
+	}
+}
+
+// resolve finds the schema a $ref points to. Only references into the same
+// schema are supported, e.g. #/definitions/port.
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within %s are supported", ref, File)
+	}
+	node := s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]interface{}:
+			next, ok := n[part]
+			if !ok {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			node = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// pointer appends a reference token to a JSON pointer, escaping ~ and /
+func pointer(path, token string) string {
+	return path + "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// normalize converts the numbers and collections decoded from YAML, or set
+// with --set, to the types encoding/json produces, so values compare the
+// same way whatever their origin
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64, []interface{}, map[string]interface{}:
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = item
+		}
+		return m
+	}
+	if f, ok := number(value); ok {
+		return f
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	}
+	return value
+}
+
+// number converts any Go number to a float64
+func number(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// typeOf returns the JSON Schema type of a normalized value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// typeMatches reports whether a normalized value has one of the types of a
+// type keyword, which is a type name or a list of them
+func typeMatches(t interface{}, value interface{}) bool {
+	actual := typeOf(value)
+	matches := func(name interface{}) bool {
+		return name == actual || (name == "number" && actual == "integer")
+	}
+	if list, ok := t.([]interface{}); ok {
+		for _, name := range list {
+			if matches(name) {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(t)
+}
+
+// typeList formats a type keyword for messages
+func typeList(t interface{}) string {
+	list, ok := t.([]interface{})
+	if !ok {
+		return fmt.Sprint(t)
+	}
+	names := make([]string, len(list))
+	for i, name := range list {
+		names[i] = fmt.Sprint(name)
+	}
+	return strings.Join(names, " or ")
+}
+
+// equal compares two values the way JSON Schema does, so 1 and 1.0 are equal
+func equal(a, b interface{}) bool {
+	a, b = normalize(a), normalize(b)
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func jsonList(list []interface{}) string {
+	items := make([]string, len(list))
+	for i, v := range list {
+		items[i] = toJSON(v)
+	}
+	return strings.Join(items, ", ")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		values   string
+		expected []string
+	}{
+		{
+			name:   "valid values",
+			schema: `{"type":"object","properties":{"replicas":{"type":"integer","minimum":1},"image":{"type":"object","properties":{"tag":{"type":"string"}}}}}`,
+			values: "replicas: 2\nimage:\n  tag: \"1.0\"\n",
+		},
+		{
+			name:     "type mismatch",
+			schema:   `{"properties":{"replicas":{"type":"integer"}}}`,
+			values:   "replicas: two\n",
+			expected: []string{"/replicas: expected integer, got string"},
+		},
+		{
+			name:     "integer is not a fraction",
+			schema:   `{"properties":{"replicas":{"type":"integer"}}}`,
+			values:   "replicas: 1.5\n",
+			expected: []string{"/replicas: expected integer, got number"},
+		},
+		{
+			name:   "integer is a number",
+			schema: `{"properties":{"ratio":{"type":"number"}}}`,
+			values: "ratio: 3\n",
+		},
+		{
+			name:   "type list",
+			schema: `{"properties":{"port":{"type":["integer","string"]}}}`,
+			values: "port: http\n",
+		},
+		{
+			name:     "null type",
+			schema:   `{"properties":{"tag":{"type":"string"}}}`,
+			values:   "tag: null\n",
+			expected: []string{"/tag: expected string, got null"},
+		},
+		{
+			name:     "required",
+			schema:   `{"properties":{"image":{"required":["repo","tag"]}}}`,
+			values:   "image:\n  tag: x\n",
+			expected: []string{"/image/repo: is required"},
+		},
+		{
+			name:     "additional properties",
+			schema:   `{"properties":{"a":{}},"additionalProperties":false}`,
+			values:   "a: 1\nb: 2\n",
+			expected: []string{"/b: additional property is not allowed"},
+		},
+		{
+			name:     "additional properties schema",
+			schema:   `{"additionalProperties":{"type":"string"}}`,
+			values:   "a: x\nb: 2\n",
+			expected: []string{"/b: expected string, got integer"},
+		},
+		{
+			name:     "pattern properties",
+			schema:   `{"patternProperties":{"^port":{"type":"integer"}},"additionalProperties":false}`,
+			values:   "portA: 80\nportB: x\n",
+			expected: []string{"/portB: expected integer, got string"},
+		},
+		{
+			name:     "enum and const",
+			schema:   `{"properties":{"pullPolicy":{"enum":["Always","IfNotPresent"]},"kind":{"const":"web"}}}`,
+			values:   "pullPolicy: Never\nkind: api\n",
+			expected: []string{`/kind: must be "web"`, `/pullPolicy: must be one of "Always", "IfNotPresent"`},
+		},
+		{
+			name:     "numeric bounds",
+			schema:   `{"properties":{"a":{"minimum":1},"b":{"maximum":10},"c":{"exclusiveMinimum":0},"d":{"multipleOf":5}}}`,
+			values:   "a: 0\nb: 11\nc: 0\nd: 7\n",
+			expected: []string{"/a: must be greater than or equal to 1", "/b: must be less than or equal to 10", "/c: must be greater than 0", "/d: must be a multiple of 5"},
+		},
+		{
+			name:     "draft 4 exclusive minimum",
+			schema:   `{"properties":{"a":{"minimum":1,"exclusiveMinimum":true}}}`,
+			values:   "a: 1\n",
+			expected: []string{"/a: must be greater than 1"},
+		},
+		{
+			name:     "string keywords",
+			schema:   `{"properties":{"name":{"minLength":3,"maxLength":5,"pattern":"^[a-z]+$"}}}`,
+			values:   "name: AB\n",
+			expected: []string{"/name: length must be at least 3", `/name: must match pattern "^[a-z]+$"`},
+		},
+		{
+			name:     "array items",
+			schema:   `{"properties":{"ports":{"type":"array","minItems":1,"uniqueItems":true,"items":{"type":"integer"}}}}`,
+			values:   "ports: [80, x, 80]\n",
+			expected: []string{"/ports: items 0 and 2 are equal", "/ports/1: expected integer, got string"},
+		},
+		{
+			name:     "tuple items",
+			schema:   `{"properties":{"pair":{"items":[{"type":"string"},{"type":"integer"}],"additionalItems":false}}}`,
+			values:   "pair: [a, 1, 2]\n",
+			expected: []string{"/pair/2: no value is allowed here"},
+		},
+		{
+			name:     "anyOf and oneOf",
+			schema:   `{"properties":{"a":{"anyOf":[{"type":"string"},{"type":"boolean"}]},"b":{"oneOf":[{"type":"integer"},{"minimum":0}]}}}`,
+			values:   "a: 1\nb: 1\n",
+			expected: []string{"/a: must match at least one schema of anyOf", "/b: must match exactly one schema of oneOf, matched 2"},
+		},
+		{
+			name:     "if then else",
+			schema:   `{"if":{"properties":{"tls":{"const":true}}},"then":{"required":["cert"]}}`,
+			values:   "tls: true\n",
+			expected: []string{"/cert: is required"},
+		},
+		{
+			name:     "ref to definitions",
+			schema:   `{"definitions":{"port":{"type":"integer","maximum":65535}},"properties":{"http":{"$ref":"#/definitions/port"}}}`,
+			values:   "http: 70000\n",
+			expected: []string{"/http: must be less than or equal to 65535"},
+		},
+		{
+			name:     "ref to the root is circular",
+			schema:   `{"$ref":"#"}`,
+			values:   "a: 1\n",
+			expected: []string{"(root): circular $ref \"#\""},
+		},
+		{
+			name:     "self-referencing definition is circular",
+			schema:   `{"definitions":{"loop":{"anyOf":[{"$ref":"#/definitions/loop"}]}},"properties":{"a":{"$ref":"#/definitions/loop"}}}`,
+			values:   "a: 1\n",
+			expected: []string{"/a: must match at least one schema of anyOf"},
+		},
+		{
+			name:     "recursive ref into child values",
+			schema:   `{"definitions":{"node":{"properties":{"name":{"type":"string"},"children":{"items":{"$ref":"#/definitions/node"}}}}},"$ref":"#/definitions/node"}`,
+			values:   "name: a\nchildren:\n- name: b\n  children:\n  - name: 3\n",
+			expected: []string{"/children/0/children/0/name: expected string, got integer"},
+		},
+		{
+			name:     "pointer escaping",
+			schema:   `{"properties":{"annotations":{"additionalProperties":{"type":"string"}}}}`,
+			values:   "annotations:\n  kubernetes.io/port: 80\n",
+			expected: []string{"/annotations/kubernetes.io~1port: expected string, got integer"},
+		},
+		{
+			name:     "every violation is reported",
+			schema:   `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["c"]}`,
+			values:   "a: 1\nb: 2\n",
+			expected: []string{"/a: expected string, got integer", "/b: expected string, got integer", "/c: is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var values interface{}
+			if err := yaml.Unmarshal([]byte(tt.values), &values); err != nil {
+				t.Fatalf("values: %v", err)
+			}
+			var got []string
+			for _, v := range s.Validate(values) {
+				got = append(got, v.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{name: "invalid json", schema: `{`, err: "unexpected end of JSON input"},
+		{name: "not an object", schema: `[]`, err: "must be an object or a boolean"},
+		{name: "invalid pattern", schema: `{"properties":{"a":{"pattern":"("}}}`, err: "invalid pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
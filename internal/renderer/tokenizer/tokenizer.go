@@ -28,6 +28,12 @@ func Tokenize(blocks types.DocumentBlocks) []types.Token {
 	return tokens
 }
 
+// TokenizeSource tokenizes a whole template source, such as a .tpl file,
+// without splitting it into YAML blocks first
+func TokenizeSource(content string) []types.Token {
+	return tokenizeContent(content, 1, 0)
+}
+
 // tokenizeContent tokenizes the content string into Text and Action tokens
 func tokenizeContent(content string, startLine int, indent int) []types.Token {
 	var tokens []types.Token
@@ -35,6 +41,8 @@ func tokenizeContent(content string, startLine int, indent int) []types.Token {
 	line := startLine
 	for i < len(content) {
 		if content[i] == '\n' {
+			// A newline directly after an action is kept as its own text token
+			tokens = append(tokens, types.Token{Type: types.TokenText, Value: "\n", Line: line, Indent: indent})
 			line++
 			i++
 			continue
@@ -109,9 +117,10 @@ func classifyAction(action string) types.TokenType {
 		return types.TokenAction
 	}
 	inner := strings.TrimSpace(strings.TrimSuffix(action, "}}")[2:])
+	words := strings.Fields(inner)
 	if strings.HasPrefix(inner, "if ") || inner == "if" {
 		return types.TokenIf
-	} else if inner == "else" {
+	} else if inner == "else" || (len(words) > 1 && words[0] == "else" && (words[1] == "if" || words[1] == "with")) {
 		return types.TokenElse
 	} else if inner == "end" {
 		return types.TokenEnd
@@ -119,6 +128,10 @@ func classifyAction(action string) types.TokenType {
 		return types.TokenRange
 	} else if strings.HasPrefix(inner, "with ") || inner == "with" {
 		return types.TokenWith
+	} else if strings.HasPrefix(inner, "define ") {
+		return types.TokenDefine
+	} else if strings.HasPrefix(inner, "template ") {
+		return types.TokenTemplate
 	}
 	return types.TokenAction
 }
\ No newline at end of file
@@ -0,0 +1,37 @@
+package tokens
+
+import (
+	"testing"
+
+	"helmish/internal/renderer/types"
+)
+
+func TestClassifyAction(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected types.TokenType
+	}{
+		{action: "{{ if .Values.a }}", expected: types.TokenIf},
+		{action: "{{if}}", expected: types.TokenIf},
+		{action: "{{ else }}", expected: types.TokenElse},
+		{action: "{{ else if .Values.b }}", expected: types.TokenElse},
+		{action: "{{ else if }}", expected: types.TokenElse},
+		{action: "{{else\tif .Values.b}}", expected: types.TokenElse},
+		{action: "{{ else with }}", expected: types.TokenElse},
+		{action: "{{ end }}", expected: types.TokenEnd},
+		{action: "{{ range .Values.items }}", expected: types.TokenRange},
+		{action: "{{ with .Values.c }}", expected: types.TokenWith},
+		{action: `{{ define "x" }}`, expected: types.TokenDefine},
+		{action: `{{ template "x" . }}`, expected: types.TokenTemplate},
+		{action: "{{ .Values.elsewhere }}", expected: types.TokenAction},
+		{action: "{{ iff .Values.a }}", expected: types.TokenAction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			if got := classifyAction(tt.action); got != tt.expected {
+				t.Errorf("classifyAction(%q) = %v, want %v", tt.action, got, tt.expected)
+			}
+		})
+	}
+}
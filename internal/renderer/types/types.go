@@ -1,10 +1,10 @@
 package types
 
 import (
-	"bytes"
 	"fmt"
+	"io/fs"
+	"reflect"
 	"strings"
-	"text/template"
 )
 
 // TokenType represents the type of token
@@ -18,6 +18,8 @@ const (
 	TokenRange
 	TokenWith
 	TokenAction
+	TokenDefine
+	TokenTemplate
 )
 
 // String returns the string representation of the token type
@@ -37,6 +39,10 @@ func (t TokenType) String() string {
 		return "With"
 	case TokenAction:
 		return "Action"
+	case TokenDefine:
+		return "Define"
+	case TokenTemplate:
+		return "Template"
 	default:
 		return "Unknown"
 	}
@@ -52,207 +58,290 @@ type Token struct {
 	TrimRight  bool // true if action ended with -}}
 }
 
-// TemplateData holds the data passed to templates
-type TemplateData struct {
-	Values interface{}
-	Chart  interface{}
+// FuncMap maps template function names to functions. Like text/template,
+// a function may return a single value, or a value and an error.
+type FuncMap map[string]interface{}
+
+// NamedTemplate is a template declared with {{ define "name" }} that can be
+// executed by name from {{ template }} and include
+type NamedTemplate interface {
+	Execute(ctx *EvalContext) ([]Token, error)
 }
 
-// EvalContext holds the context for evaluating expressions
-type EvalContext struct {
-	Values interface{}
-	Chart  interface{}
-	Root   interface{} // always points to the original root values (for $)
+// Templates maps template names to their definitions
+type Templates map[string]NamedTemplate
+
+// Scope holds the template variables declared at one level of nesting.
+// Blocks such as if, range and with open a child scope, so variables declared
+// inside them are dropped at the matching end, while assignments to
+// variables of an enclosing scope remain visible after it.
+type Scope struct {
+	vars   map[string]interface{}
+	parent *Scope
 }
 
-// Evaluate evaluates the given expression using the context
-func (ec *EvalContext) Evaluate(expr string) (interface{}, error) {
-	// Strip {{ }} from the expression
-	if len(expr) < 4 || !strings.HasPrefix(expr, "{{") || !strings.HasSuffix(expr, "}}") {
-		// Not a valid action, return as is
-		return expr, nil
-	}
-	inner := expr[2 : len(expr)-2]
-	inner = strings.TrimSpace(inner)
-
-	// Try to get the value directly first (for field access like .name, .Values.items, etc.)
-	// This handles range contexts properly where . refers to the current item
-	// Also handles $ and $. which reference the root context
-	if strings.HasPrefix(inner, ".") || strings.HasPrefix(inner, "$") {
-		val, err := ec.GetValue(inner)
-		if err == nil {
-			return val, nil
+// NewScope creates a scope nested inside parent, which may be nil
+func NewScope(parent *Scope) *Scope {
+	return &Scope{vars: make(map[string]interface{}), parent: parent}
+}
+
+// Declare defines a variable in this scope, shadowing any outer variable
+// of the same name
+func (s *Scope) Declare(name string, value interface{}) {
+	s.vars[name] = value
+}
+
+// Assign sets an already declared variable in the innermost scope that
+// defines it
+func (s *Scope) Assign(name string, value interface{}) error {
+	for sc := s; sc != nil; sc = sc.parent {
+		if _, ok := sc.vars[name]; ok {
+			sc.vars[name] = value
+			return nil
 		}
-		// If GetValue fails, fall through to template evaluation
 	}
+	return fmt.Errorf("undefined variable: %s", name)
+}
 
-	// Implement expression evaluation using template
-	result, err := ec.evaluateExpression(inner)
-	if err != nil {
-		// If evaluation fails, return the inner expression as is
-		return inner, nil
+// Lookup returns the value of a variable from the innermost scope that
+// defines it
+func (s *Scope) Lookup(name string) (interface{}, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[name]; ok {
+			return v, true
+		}
 	}
-	return result, nil
+	return nil, false
 }
 
-// EvaluateSimple evaluates a simple expression without logical operators
-func (ec *EvalContext) EvaluateSimple(expr string) (interface{}, error) {
-	if len(expr) < 4 || !strings.HasPrefix(expr, "{{") || !strings.HasSuffix(expr, "}}") {
-		return nil, fmt.Errorf("invalid expression")
-	}
-	inner := expr[2 : len(expr)-2]
-	inner = strings.TrimSpace(inner)
-
-	// Try to get the value directly first (for field access like .name, .Values.items, etc.)
-	// This handles range contexts properly where . refers to the current item
-	// Also handles $ and $. which reference the root context
-	if strings.HasPrefix(inner, ".") || strings.HasPrefix(inner, "$") {
-		val, err := ec.GetValue(inner)
-		if err == nil {
-			return val, nil
-		}
-		// If GetValue fails, fall through to template evaluation
+// NewRoot returns the top-level object templates are rendered with. As in
+// Helm, . starts out as this object and $ always refers to it. Members that
+// have no data yet are empty maps, so field access on them yields nil.
+func NewRoot(values, chart interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Values":       values,
+		"Chart":        chart,
+		"Release":      map[string]interface{}{},
+		"Capabilities": map[string]interface{}{},
+		"Files":        map[string]interface{}{},
+		"Template":     map[string]interface{}{},
 	}
+}
+
+// MaxTemplateDepth is the number of nested template calls, through
+// template, include or tpl, after which a render fails. Like Helm's limit,
+// it stops templates that call themselves.
+const MaxTemplateDepth = 1000
 
-	return ec.evaluateSimpleExpression(inner)
+// TemplateCalls tracks the nesting of template calls during a render. The
+// contexts derived from one another share it.
+type TemplateCalls struct {
+	Depth int
+	Err   error // set once the calls nest deeper than MaxTemplateDepth
 }
 
-// evaluateExpression evaluates the inner expression
-func (ec *EvalContext) evaluateExpression(expr string) (interface{}, error) {
-	// For now, just simple expressions
-	return ec.evaluateSimpleExpression(expr)
+// EvalContext holds the context for evaluating expressions
+type EvalContext struct {
+	Dot       interface{}    // the current value of .
+	Root      interface{}    // the top-level object, always reachable as $
+	Funcs     FuncMap        // functions callable from pipelines
+	Templates Templates      // named templates available to {{ template }} and include
+	Vars      *Scope         // template variables ($name) visible at this point
+	Calls     *TemplateCalls // nesting of the template calls in progress
 }
 
-// evaluateSimpleExpression evaluates a simple expression using text/template
-func (ec *EvalContext) evaluateSimpleExpression(expr string) (interface{}, error) {
-	// Create a template with the expression wrapped in {{ }}
-	tmplStr := "{{" + expr + "}}"
-	tmpl, err := template.New("").Parse(tmplStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %v", err)
+// EnterTemplate records a call of the named template and returns the
+// function that ends it. Once the calls nest deeper than MaxTemplateDepth it
+// fails, and the error is kept in Calls so enclosing calls can return it
+// without wrapping it once per level.
+func (ec *EvalContext) EnterTemplate(name string) (func(), error) {
+	if ec.Calls == nil {
+		ec.Calls = &TemplateCalls{}
 	}
-
-	data := TemplateData{
-		Values: ec.Values,
-		Chart:  ec.Chart,
+	calls := ec.Calls
+	if calls.Depth >= MaxTemplateDepth {
+		calls.Err = fmt.Errorf("rendering template has a nested reference name: %s: exceeded maximum template depth (%d)", name, MaxTemplateDepth)
+		return nil, calls.Err
 	}
+	calls.Depth++
+	return func() {
+		calls.Depth--
+		if calls.Depth == 0 {
+			calls.Err = nil
+		}
+	}, nil
+}
 
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute template: %v", err)
-	}
+// WithDot returns a copy of the context with . bound to the given value
+func (ec *EvalContext) WithDot(dot interface{}) *EvalContext {
+	scoped := *ec
+	scoped.Dot = dot
+	return &scoped
+}
+
+// WithRoot returns a copy of the context with both . and $ bound to root
+func (ec *EvalContext) WithRoot(root interface{}) *EvalContext {
+	scoped := *ec
+	scoped.Dot = root
+	scoped.Root = root
+	return &scoped
+}
+
+// WithScope returns a copy of the context with a new variable scope nested
+// in the current one
+func (ec *EvalContext) WithScope() *EvalContext {
+	scoped := *ec
+	scoped.Vars = NewScope(ec.Vars)
+	return &scoped
+}
 
-	return buf.String(), nil
+// ForTemplate returns a copy of the context for executing a named template.
+// Like text/template, both . and $ are bound to the data passed in and the
+// caller's variables are not visible.
+func (ec *EvalContext) ForTemplate(data interface{}) *EvalContext {
+	scoped := ec.WithRoot(data)
+	scoped.Vars = NewScope(nil)
+	return scoped
 }
 
-// GetValue retrieves a value from the context by path (e.g., ".Values.items" or ".Chart.name")
-// This returns the actual typed value, not a string representation
+// GetValue resolves a field path such as ".Values.items" against the current
+// dot, "$.Values.items" against the root, or "$name.field" against a
+// template variable. It returns the typed value.
 func (ec *EvalContext) GetValue(path string) (interface{}, error) {
 	path = strings.TrimSpace(path)
 
-	// Handle the root
-	if path == "." {
-		return ec.Values, nil
-	}
-
-	// Handle $ (root context) — always refers back to the original root values
-	if path == "$" {
+	switch {
+	case path == ".":
+		return ec.Dot, nil
+	case path == "$":
 		return ec.Root, nil
-	}
-
-	// Handle $.something — resolve from the root context
-	if strings.HasPrefix(path, "$.") {
-		if ec.Root == nil {
-			return nil, fmt.Errorf("root context is nil")
+	case strings.HasPrefix(path, "$."):
+		return traversePath(ec.Root, strings.Split(path[2:], "."))
+	case strings.HasPrefix(path, "$"):
+		name, rest := path, ""
+		if idx := strings.Index(path, "."); idx >= 0 {
+			name, rest = path[:idx], path[idx+1:]
 		}
-		// Create a temporary context rooted at Root to resolve the rest of the path
-		rootCtx := &EvalContext{
-			Values: ec.Root,
-			Chart:  ec.Chart,
-			Root:   ec.Root,
+		val, ok := ec.Vars.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("undefined variable: %s", name)
 		}
-		return rootCtx.GetValue("." + path[2:]) // $.foo -> .foo
-	}
-
-	// Remove leading dot if present
-	if strings.HasPrefix(path, ".") {
-		path = path[1:]
-	}
-
-	parts := strings.Split(path, ".")
-	if len(parts) == 0 {
-		return ec.Values, nil
+		return traversePath(val, strings.Split(rest, "."))
 	}
+	return traversePath(ec.Dot, strings.Split(strings.TrimPrefix(path, "."), "."))
+}
 
-	// Get the root value
-	var current interface{}
-	switch parts[0] {
-	case "Values":
-		current = ec.Values
-	case "Chart":
-		current = ec.Chart
-	case "":
-		current = ec.Values
-	default:
-		// Try to get from Values first, then Chart
-		if ec.Values != nil {
-			current = ec.Values
-			// Re-add the first part since it's not a namespace
-			parts = append([]string{""}, parts...)
-		} else {
-			return nil, fmt.Errorf("unknown root: %s", parts[0])
-		}
-	}
+// FieldPath resolves a dotted field path such as ".a.b" against a value
+func FieldPath(value interface{}, path string) (interface{}, error) {
+	return traversePath(value, strings.Split(strings.TrimPrefix(path, "."), "."))
+}
 
-	// Traverse the path
-	for i := 1; i < len(parts); i++ {
-		part := parts[i]
+// traversePath walks the field names in parts starting from current
+func traversePath(current interface{}, parts []string) (interface{}, error) {
+	for _, part := range parts {
 		if part == "" {
 			continue
 		}
 
+		// Missing map keys evaluate to nil, like Helm's missingkey=zero
 		switch v := current.(type) {
 		case map[string]interface{}:
-			val, ok := v[part]
-			if !ok {
-				return nil, fmt.Errorf("key not found: %s", part)
-			}
-			current = val
+			current = v[part]
 		case map[interface{}]interface{}:
-			val, ok := v[part]
-			if !ok {
-				return nil, fmt.Errorf("key not found: %s", part)
-			}
-			current = val
+			current = v[part]
+		case nil:
+			return nil, fmt.Errorf("nil pointer evaluating interface {}.%s", part)
 		default:
-			// Try using reflection for struct access
-			return nil, fmt.Errorf("cannot access field %s on type %T", part, current)
+			next, err := fieldOf(current, part)
+			if err != nil {
+				return nil, err
+			}
+			current = next
 		}
 	}
 
 	return current, nil
 }
 
-// IsTruthy determines if a value is truthy
-func IsTruthy(v interface{}) bool {
-	switch val := v.(type) {
-	case bool:
-		return val
-	case string:
-		if val == "true" {
-			return true
-		} else if val == "false" {
-			return false
-		} else {
-			return val != ""
+// fieldOf resolves a single field name against a typed value. Like
+// text/template, a method without arguments is called, then struct fields
+// and the keys of maps with string keys are looked up.
+func fieldOf(value interface{}, name string) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	if method := v.MethodByName(name); method.IsValid() {
+		if method.Type().NumIn() != 0 {
+			return nil, fmt.Errorf("%s has arguments but cannot be invoked as a field", name)
+		}
+		out := method.Call(nil)
+		if len(out) == 2 && !out[1].IsNil() {
+			return nil, fmt.Errorf("error calling %s: %v", name, out[1].Interface())
 		}
-	case nil:
+		if len(out) == 0 {
+			return nil, nil
+		}
+		return out[0].Interface(), nil
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil pointer evaluating %s.%s", v.Type(), name)
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if field, ok := v.Type().FieldByName(name); ok && field.IsExported() {
+			return v.FieldByIndex(field.Index).Interface(), nil
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			elem := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !elem.IsValid() {
+				return nil, nil
+			}
+			return elem.Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("can't evaluate field %s in type %T", name, value)
+}
+
+// Method returns the method called name of value bound to it, so it can be
+// called with arguments as the last element of a field chain
+func Method(value interface{}, name string) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	method := reflect.ValueOf(value).MethodByName(name)
+	if !method.IsValid() {
+		return nil, false
+	}
+	return method.Interface(), true
+}
+
+// IsTruthy determines if a value is truthy. Like text/template, false, 0,
+// nil, empty strings and empty collections are falsy; everything else,
+// including the string "false", is truthy.
+func IsTruthy(v interface{}) bool {
+	if v == nil {
 		return false
-	default:
-		// For numbers, etc., consider non-zero as true, but for simplicity, true
-		return true
 	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() > 0
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() != 0
+	case reflect.Complex64, reflect.Complex128:
+		return val.Complex() != 0
+	case reflect.Chan, reflect.Func, reflect.Pointer, reflect.Interface:
+		return !val.IsNil()
+	}
+	return true
 }
 
 // BlockContent represents content that can be raw or rendered
@@ -368,28 +457,74 @@ type Values map[string]ValueData
 // Metadata holds the chart metadata files (filename -> ValueData)
 type Metadata map[string]ValueData
 
-// YamlTemplates holds the YAML template files (filename -> content)
+// YamlTemplates holds the template files that render manifests: .yaml, .yml
+// and .json files (filename -> content)
 type YamlTemplates map[string]string
 
-// TplFiles holds the template files (filename -> content)
+// TplFiles holds the partials: .tpl files and files whose name starts with
+// _, which define named templates but render nothing (filename -> content)
 type TplFiles map[string]string
 
+// ChartFiles holds the non-template files of the chart (slash separated
+// path relative to the chart root -> content)
+type ChartFiles map[string][]byte
+
 // Chart represents the Helm chart data
 type Chart struct {
 	Path          string
+	FS            fs.FS // the chart's files, rooted at the chart directory
 	Values        Values
 	Metadata      Metadata
 	YamlTemplates YamlTemplates
 	TplFiles      TplFiles
+	Files         ChartFiles
+	Notes         string     // content of templates/NOTES.txt, "" if the chart has none
+	CRDs          ChartFiles // files of crds/, emitted as they are (path relative to crds/ -> content)
+	Schema        []byte     // content of values.schema.json, nil if the chart has none
+	Dependencies  []Chart    // subcharts loaded from charts/, sorted by directory name
+	Ignored       []string   // paths excluded by .helmignore, subcharts included, relative to the chart
+}
+
+// Dependency is a subchart of a render and whether the values enable it
+type Dependency struct {
+	Name    string // the name of the subchart
+	Alias   string // the name the subchart is used under, if it differs
+	Path    string // path from the top-level chart, e.g. charts/redis
+	Enabled bool
 }
 
 // Profile represents the profile options
 type Profile struct {
 	Name          string
 	Capabilities  Capabilities
+	Release       Release
+	Values        map[string]interface{} // overlaid on the chart values
+	Chain         []ProfileLayer         // the profiles merged into this one, base first
 	// Add more fields as needed
 }
 
+// ProfileLayer is one profile file of a resolved profile, holding only the
+// settings that file itself declares
+type ProfileLayer struct {
+	Name         string
+	Path         string
+	Extends      []string
+	Capabilities Capabilities
+	Release      Release
+	Values       map[string]interface{}
+}
+
+// Release holds the release settings exposed to templates as .Release.
+// Empty fields fall back to the defaults of helm template. IsInstall is
+// derived from IsUpgrade.
+type Release struct {
+	Name      string
+	Namespace string
+	Revision  int
+	IsUpgrade *bool // nil when unset, so an override can turn it off
+	Service   string
+}
+
 // Capabilities represents Helm capabilities
 type Capabilities struct {
 	KubeVersion string
@@ -398,6 +533,21 @@ type Capabilities struct {
 
 // Options holds the options for rendering
 type Options struct {
-	Chart   Chart
-	Profile Profile
+	Chart       Chart
+	Profile     Profile
+	ValuesFiles []ValueFile // user values files, in increasing precedence
+	// Set, SetString, SetJSON and SetFile hold the expressions of helm's
+	// --set, --set-string, --set-json and --set-file flags. They are
+	// applied after the values files, in the order helm applies them.
+	Set       []string
+	SetString []string
+	SetJSON   []string
+	SetFile   []string
+	SkipCRDs  bool // don't emit the files of the crds/ directories
+}
+
+// ValueFile is a user supplied values file
+type ValueFile struct {
+	Path string
+	ValueData
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+// Package values merges layers of chart values
+package values
+
+// Merge deep-merges overlay on top of base and returns the result. Maps are
+// merged key by key, anything else in overlay, including null, replaces the
+// value in base. This is how Helm combines several values files before they
+// are applied to the chart defaults. Neither input is modified.
+func Merge(base, overlay map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		if src, ok := v.(map[string]interface{}); ok {
+			if dst, ok := out[k].(map[string]interface{}); ok {
+				out[k] = Merge(dst, src)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Coalesce applies user supplied values on top of chart defaults following
+// Helm's rules: maps merge deeply, lists and scalars replace, and a null
+// deletes the key from the defaults. Neither input is modified.
+func Coalesce(defaults, user map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(defaults)+len(user))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range user {
+		switch src := v.(type) {
+		case nil:
+			delete(out, k)
+		case map[string]interface{}:
+			dst, _ := out[k].(map[string]interface{})
+			out[k] = Coalesce(dst, src)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Copy returns a deep copy of values, so templates that modify the copy,
+// e.g. with set, leave the chart's values alone
+func Copy(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	return copyValue(values).(map[string]interface{})
+}
+
+// copyValue returns a copy of v, recursively copying maps and lists
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = copyValue(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = copyValue(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
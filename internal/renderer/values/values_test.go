@@ -0,0 +1,130 @@
+package values
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     map[string]interface{}
+		overlay  map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "nested maps merge",
+			base:     map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "1.0"}},
+			overlay:  map[string]interface{}{"image": map[string]interface{}{"tag": "2.0"}},
+			expected: map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "2.0"}},
+		},
+		{
+			name:     "lists replace",
+			base:     map[string]interface{}{"args": []interface{}{"a", "b"}},
+			overlay:  map[string]interface{}{"args": []interface{}{"c"}},
+			expected: map[string]interface{}{"args": []interface{}{"c"}},
+		},
+		{
+			name:     "scalar replaces map",
+			base:     map[string]interface{}{"x": map[string]interface{}{"a": 1}},
+			overlay:  map[string]interface{}{"x": "flat"},
+			expected: map[string]interface{}{"x": "flat"},
+		},
+		{
+			name:     "null replaces",
+			base:     map[string]interface{}{"a": 1},
+			overlay:  map[string]interface{}{"a": nil},
+			expected: map[string]interface{}{"a": nil},
+		},
+		{
+			name:     "nil base",
+			overlay:  map[string]interface{}{"a": 1},
+			expected: map[string]interface{}{"a": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Merge(tt.base, tt.overlay); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults map[string]interface{}
+		user     map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "nested maps merge",
+			defaults: map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "1.0"}, "replicas": 1},
+			user:     map[string]interface{}{"image": map[string]interface{}{"tag": "2.0"}},
+			expected: map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "2.0"}, "replicas": 1},
+		},
+		{
+			name:     "lists replace",
+			defaults: map[string]interface{}{"args": []interface{}{"a", "b"}},
+			user:     map[string]interface{}{"args": []interface{}{}},
+			expected: map[string]interface{}{"args": []interface{}{}},
+		},
+		{
+			name:     "null deletes a default key",
+			defaults: map[string]interface{}{"a": 1, "b": 2},
+			user:     map[string]interface{}{"a": nil},
+			expected: map[string]interface{}{"b": 2},
+		},
+		{
+			name:     "null deletes a nested default map",
+			defaults: map[string]interface{}{"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}, "requests": "x"}},
+			user:     map[string]interface{}{"resources": map[string]interface{}{"limits": nil}},
+			expected: map[string]interface{}{"resources": map[string]interface{}{"requests": "x"}},
+		},
+		{
+			name:     "null for a key without default",
+			defaults: map[string]interface{}{"a": 1},
+			user:     map[string]interface{}{"b": map[string]interface{}{"c": nil, "d": 1}},
+			expected: map[string]interface{}{"a": 1, "b": map[string]interface{}{"d": 1}},
+		},
+		{
+			name:     "map replaces scalar",
+			defaults: map[string]interface{}{"x": "flat"},
+			user:     map[string]interface{}{"x": map[string]interface{}{"a": 1}},
+			expected: map[string]interface{}{"x": map[string]interface{}{"a": 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Coalesce(tt.defaults, tt.user); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	src := map[string]interface{}{
+		"image": map[string]interface{}{"repo": "nginx"},
+		"args":  []interface{}{"a", map[string]interface{}{"b": 1}},
+	}
+	out := Copy(src)
+	if !reflect.DeepEqual(out, src) {
+		t.Fatalf("expected %v, got %v", src, out)
+	}
+	out["image"].(map[string]interface{})["repo"] = "httpd"
+	out["args"].([]interface{})[1].(map[string]interface{})["b"] = 2
+	expected := map[string]interface{}{
+		"image": map[string]interface{}{"repo": "nginx"},
+		"args":  []interface{}{"a", map[string]interface{}{"b": 1}},
+	}
+	if !reflect.DeepEqual(src, expected) {
+		t.Errorf("modifying the copy changed the source: %v", src)
+	}
+	if Copy(nil) != nil {
+		t.Errorf("expected nil for a nil map")
+	}
+}
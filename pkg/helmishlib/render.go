@@ -1,7 +1,11 @@
 package helmishlib
 
 import (
+	"io/fs"
+	"path/filepath"
+
 	"helmish/internal/renderer"
+	"helmish/internal/renderer/profile"
 	"helmish/internal/renderer/types"
 )
 
@@ -44,15 +48,42 @@ const TokenAction = types.TokenAction
 // Chart represents the Helm chart data
 type Chart = renderer.Chart
 
+// Release holds the release settings exposed to templates as .Release
+type Release = renderer.Release
+
+// ProfileLayer is one profile file of a resolved profile, holding only the
+// settings that file itself declares
+type ProfileLayer = renderer.ProfileLayer
+
+// Dependency is a subchart of the chart and whether it is enabled
+type Dependency = renderer.Dependency
+
 // Profile represents the profile options (public, minimal)
 type Profile struct {
-	Name string
+	Name    string
+	Dir     string  // directory searched for profile files before the chart's profiles/
+	Release Release // overrides the release settings of the named profile
+	// Chain holds the profile files merged into the profile, base first.
+	// It is filled in by LoadProfile and ignored by Render.
+	Chain []ProfileLayer
 }
 
 // Options holds the options for rendering (public)
 type Options struct {
-	Chart   Chart
 	Profile Profile
+	// ValuesFiles are extra values files layered on top of the chart
+	// defaults and the profile values, later files taking precedence, like
+	// helm's -f flag
+	ValuesFiles []string
+	// Set, SetString, SetJSON and SetFile hold expressions like those of
+	// helm's --set, --set-string, --set-json and --set-file flags. They take
+	// precedence over the values files.
+	Set       []string
+	SetString []string
+	SetJSON   []string
+	SetFile   []string
+	// SkipCRDs leaves the files of the crds/ directories out of the result
+	SkipCRDs bool
 }
 
 // Helmish is the main library struct that holds the loaded chart
@@ -60,7 +91,8 @@ type Helmish struct {
 	chart renderer.Chart
 }
 
-// NewHelmish creates a new Helmish instance by loading the chart from the given path
+// NewHelmish creates a new Helmish instance by loading the chart from the given path.
+// The path is a chart directory or a packaged chart (.tgz).
 func NewHelmish(chartPath string) (*Helmish, error) {
 	chart, err := renderer.LoadChart(chartPath)
 	if err != nil {
@@ -71,31 +103,147 @@ func NewHelmish(chartPath string) (*Helmish, error) {
 	}, nil
 }
 
-// loadProfile loads the profile from the default folder based on name
-func loadProfile(name string) (renderer.Profile, error) {
-	// Skeleton: hardcoded for now
-	// In the future, look in default folder for profile file
-	profile := renderer.Profile{
-		Name: name,
-		Capabilities: renderer.Capabilities{
-			KubeVersion: "1.25",
-			APIVersions: []string{"v1", "apps/v1"},
-		},
+// NewHelmishFS creates a new Helmish instance by loading the chart at the
+// root of a file system, e.g. an fstest.MapFS
+func NewHelmishFS(fsys fs.FS) (*Helmish, error) {
+	chart, err := renderer.LoadFS(fsys, "")
+	if err != nil {
+		return nil, err
 	}
-	return profile, nil
+	return &Helmish{
+		chart: chart,
+	}, nil
+}
+
+// Ignored returns the paths of the chart, relative to its root, that
+// .helmignore excluded when loading it
+func (h *Helmish) Ignored() []string {
+	return h.chart.Ignored
+}
+
+// loadProfile loads the named profile from the profile directory, if any,
+// and then from the chart's profiles/ directory
+func (h *Helmish) loadProfile(p Profile) (renderer.Profile, error) {
+	var sources []profile.Source
+	if p.Dir != "" {
+		sources = append(sources, profile.DirSource(p.Dir))
+	}
+	chartProfiles, err := fs.Sub(h.chart.FS, profile.Dir)
+	if err != nil {
+		return renderer.Profile{}, err
+	}
+	sources = append(sources, profile.Source{FS: chartProfiles, Dir: filepath.Join(h.chart.Path, profile.Dir)})
+	return profile.LoadFrom(p.Name, sources...)
+}
+
+// LoadProfile resolves the named profile and the profiles it extends, and
+// returns it with the resolved chain, so callers can see which layer set
+// what
+func (h *Helmish) LoadProfile(p Profile) (Profile, error) {
+	loaded, err := h.loadProfile(p)
+	if err != nil {
+		return Profile{}, err
+	}
+	p.Chain = loaded.Chain
+	return p, nil
+}
+
+// mergeRelease applies the non-empty fields of override on top of base. A
+// set IsUpgrade wins even when it is false.
+func mergeRelease(base, override Release) Release {
+	if override.Name != "" {
+		base.Name = override.Name
+	}
+	if override.Namespace != "" {
+		base.Namespace = override.Namespace
+	}
+	if override.Revision != 0 {
+		base.Revision = override.Revision
+	}
+	if override.IsUpgrade != nil {
+		base.IsUpgrade = override.IsUpgrade
+	}
+	if override.Service != "" {
+		base.Service = override.Service
+	}
+	return base
 }
 
 // Render calls the internal renderer to render the chart using the loaded chart
 func (h *Helmish) Render(profile Profile) (map[string][][]Token, error) {
-	loadedProfile, err := loadProfile(profile.Name)
+	return h.RenderWithOptions(Options{Profile: profile})
+}
+
+// RenderWithOptions renders the loaded chart with the given profile, values
+// files and set values. The crds/ files and the notes are returned by
+// RenderResult.
+func (h *Helmish) RenderWithOptions(opts Options) (map[string][][]Token, error) {
+	result, err := h.RenderResult(opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Manifests, nil
+}
+
+// Result is the output of RenderResult
+type Result struct {
+	Manifests map[string][][]Token // the rendered template files, as returned by RenderWithOptions
+	CRDs      map[string][][]Token // the crds/ files as they are, to be applied before the manifests
+	Notes     string               // the rendered templates/NOTES.txt, "" if the chart has none
+}
+
+// RenderResult renders the loaded chart like RenderWithOptions, along with
+// its NOTES.txt
+func (h *Helmish) RenderResult(opts Options) (Result, error) {
+	internalOpts, err := h.renderOptions(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	rendered, err := renderer.RenderChart(internalOpts)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Manifests: rendered.Files,
+		CRDs:      rendered.CRDs,
+		Notes:     RenderTokensToString([][]Token{rendered.Notes}),
+	}, nil
+}
+
+// Dependencies reports the subcharts of the loaded chart and which of them
+// the profile, values files and set values of opts enable
+func (h *Helmish) Dependencies(opts Options) ([]Dependency, error) {
+	internalOpts, err := h.renderOptions(opts)
 	if err != nil {
 		return nil, err
 	}
+	return renderer.ResolveDependencies(internalOpts)
+}
+
+// renderOptions loads the profile and values files of opts
+func (h *Helmish) renderOptions(opts Options) (renderer.Options, error) {
+	loadedProfile, err := h.loadProfile(opts.Profile)
+	if err != nil {
+		return renderer.Options{}, err
+	}
+	loadedProfile.Release = mergeRelease(loadedProfile.Release, opts.Profile.Release)
 	internalOpts := renderer.Options{
-		Chart:   h.chart,
-		Profile: loadedProfile,
+		Chart:     h.chart,
+		Profile:   loadedProfile,
+		Set:       opts.Set,
+		SetString: opts.SetString,
+		SetJSON:   opts.SetJSON,
+		SetFile:   opts.SetFile,
+		SkipCRDs:  opts.SkipCRDs,
+	}
+	for _, path := range opts.ValuesFiles {
+		f, err := renderer.LoadValuesFile(path)
+		if err != nil {
+			return renderer.Options{}, err
+		}
+		internalOpts.ValuesFiles = append(internalOpts.ValuesFiles, f)
 	}
-	return renderer.RenderChart(internalOpts)
+	return internalOpts, nil
 }
 
 // RenderTokensToString converts a 2D slice of tokens to a string representation.
@@ -1,9 +1,16 @@
 package helmishlib
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestGoldenIfExamples(t *testing.T) {
@@ -51,3 +58,953 @@ func TestGoldenIfExamples(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderRelease(t *testing.T) {
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":            "apiVersion: v2\nname: release-chart\nversion: 0.1.0\n",
+		"values.yaml":           "suffix: svc\n",
+		"templates/cm.yaml":     "name: {{ .Release.Name }}-{{ .Values.suffix }}\nnamespace: {{ .Release.Namespace }}\nrevision: {{ .Release.Revision }}\ninstall: {{ .Release.IsInstall }}\nupgrade: {{ .Release.IsUpgrade }}\nservice: {{ .Release.Service }}",
+		"profiles/upgrade.yaml": "release:\n  upgrade: true\n",
+	}
+	writeChart(t, chartPath, files)
+
+	tests := []struct {
+		name     string
+		profile  Profile
+		expected string
+	}{
+		{
+			name:     "helm template defaults",
+			profile:  Profile{Name: "default"},
+			expected: "name: release-name-svc\nnamespace: default\nrevision: 1\ninstall: true\nupgrade: false\nservice: Helm",
+		},
+		{
+			name:     "profile release settings",
+			profile:  Profile{Name: "default", Release: Release{Name: "web", Namespace: "prod", Revision: 3, IsUpgrade: boolPtr(true)}},
+			expected: "name: web-svc\nnamespace: prod\nrevision: 3\ninstall: false\nupgrade: true\nservice: Helm",
+		},
+		{
+			name:     "upgrade from the profile file",
+			profile:  Profile{Name: "upgrade"},
+			expected: "name: release-name-svc\nnamespace: default\nrevision: 1\ninstall: false\nupgrade: true\nservice: Helm",
+		},
+		{
+			name:     "false upgrade override wins over the profile file",
+			profile:  Profile{Name: "upgrade", Release: Release{IsUpgrade: boolPtr(false)}},
+			expected: "name: release-name-svc\nnamespace: default\nrevision: 1\ninstall: true\nupgrade: false\nservice: Helm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			tokens, err := h.Render(tt.profile)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			got := RenderAllFilesToString(tokens)["cm.yaml"]
+			if got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// writeChart writes the given files (relative path -> content) under dir
+func writeChart(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderFiles(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":                   "apiVersion: v2\nname: files-chart\nversion: 0.1.0\n",
+		"values.yaml":                  "{}\n",
+		".helmignore":                  "*.bak\nprivate/\n",
+		"config/app.conf":              "port=80\n",
+		"config/app.conf.bak":          "old\n",
+		"private/key":                  "secret\n",
+		"charts/sub/Chart.yaml":        "apiVersion: v2\nname: sub\nversion: 0.1.0\n",
+		"charts/sub/file":              "subchart\n",
+		"charts/sub/templates/cm.yaml": "data:\n  {{- (.Files.Glob \"**\").AsConfig | nindent 2 }}\n",
+		"templates/cm.yaml":            "data:\n  {{- (.Files.Glob \"**\").AsConfig | nindent 2 }}\n",
+	})
+
+	h, err := NewHelmish(chartPath)
+	if err != nil {
+		t.Fatalf("NewHelmish: %v", err)
+	}
+	tokens, err := h.Render(Profile{Name: "default"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	got := RenderAllFilesToString(tokens)["cm.yaml"]
+	want := "data:\n  app.conf: |\n    port=80"
+	if got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+	got = RenderAllFilesToString(tokens)["charts/sub/templates/cm.yaml"]
+	want = "data:\n  file: |\n    subchart"
+	if got != want {
+		t.Errorf("expected subchart files:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRenderProfile(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":            "apiVersion: v2\nname: profile-chart\nversion: 0.1.0\n",
+		"values.yaml":           "replicas: 1\nimage:\n  repo: nginx\n  tag: stable\n",
+		"profiles/staging.yaml": "values:\n  replicas: 2\n  image:\n    tag: rc\nrelease:\n  namespace: staging\ncapabilities:\n  kubeVersion: \"1.27\"\n",
+		"templates/deploy.yaml": "replicas: {{ .Values.replicas }}\nimage: {{ .Values.image.repo }}:{{ .Values.image.tag }}\nnamespace: {{ .Release.Namespace }}\nkube: {{ .Capabilities.KubeVersion }}\nfiles: {{ len .Files }}",
+	})
+	userDir := t.TempDir()
+	writeChart(t, userDir, map[string]string{
+		"local.yaml": "release:\n  namespace: local\n",
+	})
+
+	tests := []struct {
+		name     string
+		profile  Profile
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "default profile",
+			profile:  Profile{Name: "default"},
+			expected: "replicas: 1\nimage: nginx:stable\nnamespace: default\nkube: v1.31.0\nfiles: 0",
+		},
+		{
+			name:     "chart profile",
+			profile:  Profile{Name: "staging"},
+			expected: "replicas: 2\nimage: nginx:rc\nnamespace: staging\nkube: v1.27.0\nfiles: 0",
+		},
+		{
+			name:     "profile from a user directory",
+			profile:  Profile{Name: "local", Dir: userDir},
+			expected: "replicas: 1\nimage: nginx:stable\nnamespace: local\nkube: v1.31.0\nfiles: 0",
+		},
+		{
+			name:     "release override on top of the profile",
+			profile:  Profile{Name: "staging", Release: Release{Namespace: "override"}},
+			expected: "replicas: 2\nimage: nginx:rc\nnamespace: override\nkube: v1.27.0\nfiles: 0",
+		},
+		{
+			name:    "unknown profile",
+			profile: Profile{Name: "prod", Dir: userDir},
+			wantErr: "available profiles: local, staging",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			tokens, err := h.Render(tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			got := RenderAllFilesToString(tokens)["deploy.yaml"]
+			if got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadProfileChain(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":               "apiVersion: v2\nname: chain-chart\nversion: 0.1.0\n",
+		"values.yaml":              "region: none\nreplicas: 1\n",
+		"profiles/base.yaml":       "values:\n  replicas: 2\n",
+		"profiles/eu-common.yaml":  "values:\n  region: eu\n",
+		"profiles/staging.yaml":    "extends: [base]\nrelease:\n  namespace: staging\n",
+		"profiles/staging-eu.yaml": "extends: [staging, eu-common]\n",
+		"templates/cm.yaml":        "{{ .Release.Namespace }} {{ .Values.region }} {{ .Values.replicas }}",
+	})
+
+	h, err := NewHelmish(chartPath)
+	if err != nil {
+		t.Fatalf("NewHelmish: %v", err)
+	}
+	p, err := h.LoadProfile(Profile{Name: "staging-eu"})
+	if err != nil {
+		t.Fatalf("LoadProfile: %v", err)
+	}
+	var chain []string
+	for _, layer := range p.Chain {
+		chain = append(chain, layer.Name)
+	}
+	if want := "base staging eu-common staging-eu"; strings.Join(chain, " ") != want {
+		t.Errorf("expected chain %q, got %q", want, strings.Join(chain, " "))
+	}
+
+	tokens, err := h.Render(p)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got, want := RenderAllFilesToString(tokens)["cm.yaml"], "staging eu 2"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderValuesFiles(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":            "apiVersion: v2\nname: values-chart\nversion: 0.1.0\n",
+		"values.yaml":           "replicas: 1\nimage:\n  repo: nginx\n  tag: stable\nargs: [a, b]\nresources:\n  limits:\n    cpu: 1\n",
+		"profiles/staging.yaml": "values:\n  replicas: 2\n  image:\n    tag: rc\n",
+		"templates/cm.yaml":     "{{ toJson .Values }}",
+	})
+	userDir := t.TempDir()
+	writeChart(t, userDir, map[string]string{
+		"a.yaml":     "image:\n  tag: a\nargs: [c]\n",
+		"b.yaml":     "image:\n  repo: custom\nresources: null\n",
+		"c.yaml":     "image:\n  tag: null\n",
+		"empty.yaml": "",
+		"list.yaml":  "- a\n",
+	})
+
+	tests := []struct {
+		name     string
+		profile  string
+		files    []string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "chart defaults",
+			expected: `{"args":["a","b"],"image":{"repo":"nginx","tag":"stable"},"replicas":1,"resources":{"limits":{"cpu":1}}}`,
+		},
+		{
+			name:     "later files take precedence, lists replace and null deletes",
+			files:    []string{"a.yaml", "b.yaml"},
+			expected: `{"args":["c"],"image":{"repo":"custom","tag":"a"},"replicas":1}`,
+		},
+		{
+			name:     "values files apply on top of the profile",
+			profile:  "staging",
+			files:    []string{"a.yaml"},
+			expected: `{"args":["c"],"image":{"repo":"nginx","tag":"a"},"replicas":2,"resources":{"limits":{"cpu":1}}}`,
+		},
+		{
+			name:     "null in a later file deletes the default",
+			files:    []string{"a.yaml", "c.yaml"},
+			expected: `{"args":["c"],"image":{"repo":"nginx"},"replicas":1,"resources":{"limits":{"cpu":1}}}`,
+		},
+		{
+			name:     "empty file",
+			files:    []string{"empty.yaml"},
+			expected: `{"args":["a","b"],"image":{"repo":"nginx","tag":"stable"},"replicas":1,"resources":{"limits":{"cpu":1}}}`,
+		},
+		{
+			name:    "values file must be a mapping",
+			files:   []string{"list.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "missing values file",
+			files:   []string{"missing.yaml"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			opts := Options{Profile: Profile{Name: tt.profile}}
+			for _, f := range tt.files {
+				opts.ValuesFiles = append(opts.ValuesFiles, filepath.Join(userDir, f))
+			}
+			tokens, err := h.RenderWithOptions(opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got := RenderAllFilesToString(tokens)["cm.yaml"]; got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderSetValues(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":        "apiVersion: v2\nname: set-chart\nversion: 0.1.0\n",
+		"values.yaml":       "replicas: 1\nimage:\n  repo: nginx\n  tag: stable\nports: [80]\n",
+		"templates/cm.yaml": "{{ toJson .Values }}",
+	})
+	userDir := t.TempDir()
+	writeChart(t, userDir, map[string]string{
+		"a.yaml":  "replicas: 2\nimage:\n  tag: a\n",
+		"tls.crt": "CERT\n",
+	})
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "set overrides values files",
+			opts:     Options{ValuesFiles: []string{"a.yaml"}, Set: []string{"replicas=3,image.repo=custom"}},
+			expected: `{"image":{"repo":"custom","tag":"a"},"ports":[80],"replicas":3}`,
+		},
+		{
+			name:     "list indexes replace the list",
+			opts:     Options{Set: []string{"ports[0]=443,ports[1]=8443"}},
+			expected: `{"image":{"repo":"nginx","tag":"stable"},"ports":[443,8443],"replicas":1}`,
+		},
+		{
+			name:     "null deletes",
+			opts:     Options{Set: []string{"image.tag=null"}},
+			expected: `{"image":{"repo":"nginx"},"ports":[80],"replicas":1}`,
+		},
+		{
+			name:     "set-string keeps strings",
+			opts:     Options{SetString: []string{"replicas=3"}},
+			expected: `{"image":{"repo":"nginx","tag":"stable"},"ports":[80],"replicas":"3"}`,
+		},
+		{
+			name:     "set-string applies after set",
+			opts:     Options{Set: []string{"replicas=3"}, SetString: []string{"replicas=4"}},
+			expected: `{"image":{"repo":"nginx","tag":"stable"},"ports":[80],"replicas":"4"}`,
+		},
+		{
+			name:     "set-json",
+			opts:     Options{SetJSON: []string{`image={"repo":"x","pullPolicy":"Always"}`}},
+			expected: `{"image":{"pullPolicy":"Always","repo":"x","tag":"stable"},"ports":[80],"replicas":1}`,
+		},
+		{
+			name:     "set-file",
+			opts:     Options{SetFile: []string{"tls.cert=" + filepath.Join(userDir, "tls.crt")}},
+			expected: `{"image":{"repo":"nginx","tag":"stable"},"ports":[80],"replicas":1,"tls":{"cert":"CERT\n"}}`,
+		},
+		{
+			name:    "invalid expression",
+			opts:    Options{Set: []string{"replicas"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing set-file",
+			opts:    Options{SetFile: []string{"a=" + filepath.Join(userDir, "missing")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			for i, f := range tt.opts.ValuesFiles {
+				tt.opts.ValuesFiles[i] = filepath.Join(userDir, f)
+			}
+			tokens, err := h.RenderWithOptions(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got := RenderAllFilesToString(tokens)["cm.yaml"]; got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderSchemaValidation(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":            "apiVersion: v2\nname: schema-chart\nversion: 0.1.0\n",
+		"values.yaml":           "replicas: 1\nimage:\n  repo: nginx\n  tag: stable\n",
+		"values.schema.json":    `{"type":"object","required":["image"],"properties":{"replicas":{"type":"integer","minimum":1},"image":{"type":"object","required":["repo"],"properties":{"repo":{"type":"string"},"tag":{"type":"string"}}}}}`,
+		"profiles/base.yaml":    "values:\n  replicas: 0\n",
+		"profiles/staging.yaml": "extends: [base]\nvalues:\n  image:\n    tag: 2\n",
+		"templates/cm.yaml":     "replicas: {{ .Values.replicas }}",
+	})
+	userDir := t.TempDir()
+	writeChart(t, userDir, map[string]string{
+		"bad.yaml": "image:\n  repo: null\n",
+	})
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{
+			name: "valid values render",
+		},
+		{
+			name: "violations name the profile that set the value",
+			opts: Options{Profile: Profile{Name: "staging"}},
+			expected: []string{
+				`- /image/tag: expected string, got integer (from profile "staging" (` + filepath.Join(chartPath, "profiles", "staging.yaml") + `))`,
+				`- /replicas: must be greater than or equal to 1 (from profile "base" (` + filepath.Join(chartPath, "profiles", "base.yaml") + `))`,
+			},
+		},
+		{
+			name:     "a null in a values file deletes a required value",
+			opts:     Options{ValuesFiles: []string{filepath.Join(userDir, "bad.yaml")}},
+			expected: []string{"- /image/repo: is required (from values file " + filepath.Join(userDir, "bad.yaml") + ")"},
+		},
+		{
+			name:     "set values",
+			opts:     Options{Set: []string{"replicas=many"}},
+			expected: []string{"- /replicas: expected integer, got string (from --set)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			_, err = h.RenderWithOptions(tt.opts)
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected a validation error, got none")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if lines[0] != "values don't meet the specifications of the schema in values.schema.json:" {
+				t.Errorf("unexpected error header %q", lines[0])
+			}
+			if got := lines[1:]; strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestRenderSubcharts(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":                                   "apiVersion: v2\nname: umbrella\nversion: 0.1.0\n",
+		"values.yaml":                                  "global:\n  env: prod\nredis:\n  port: 6380\n",
+		"templates/cm.yaml":                            "redis: {{ toJson .Values.redis }}",
+		"templates/_helpers.tpl":                       `{{ define "common.label" }}umbrella{{ end }}`,
+		"charts/redis/Chart.yaml":                      "apiVersion: v2\nname: redis\nversion: 7.0.0\n",
+		"charts/redis/values.yaml":                     "port: 6379\nreplicas: 1\nglobal:\n  env: dev\n  zone: a\n",
+		"charts/redis/templates/svc.yaml":              "chart: {{ .Chart.Name }}\ntemplate: {{ .Template.Name }}\nvalues: {{ toJson .Values }}\nlabel: {{ include \"common.label\" . }}",
+		"charts/redis/templates/_helpers.tpl":          `{{ define "common.label" }}redis{{ end }}`,
+		"charts/redis/charts/metrics/Chart.yaml":       "apiVersion: v2\nname: metrics\nversion: 1.0.0\n",
+		"charts/redis/charts/metrics/values.yaml":      "interval: 30s\n",
+		"charts/redis/charts/metrics/templates/x.yaml": "{{ toJson .Values }}",
+	})
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[string]string
+	}{
+		{
+			name: "subcharts render with their own scope",
+			expected: map[string]string{
+				"cm.yaml": `redis: {"global":{"env":"prod","zone":"a"},"metrics":{"global":{"env":"prod","zone":"a"},"interval":"30s"},"port":6380,"replicas":1}`,
+				"charts/redis/templates/svc.yaml": "chart: redis\ntemplate: umbrella/charts/redis/templates/svc.yaml\n" +
+					`values: {"global":{"env":"prod","zone":"a"},"metrics":{"global":{"env":"prod","zone":"a"},"interval":"30s"},"port":6380,"replicas":1}` + "\nlabel: umbrella",
+				"charts/redis/charts/metrics/templates/x.yaml": `{"global":{"env":"prod","zone":"a"},"interval":"30s"}`,
+			},
+		},
+		{
+			name: "user values reach subcharts",
+			opts: Options{Set: []string{"redis.replicas=3,redis.metrics.interval=10s,global.env=staging"}},
+			expected: map[string]string{
+				"charts/redis/templates/svc.yaml": "chart: redis\ntemplate: umbrella/charts/redis/templates/svc.yaml\n" +
+					`values: {"global":{"env":"staging","zone":"a"},"metrics":{"global":{"env":"staging","zone":"a"},"interval":"10s"},"port":6380,"replicas":3}` + "\nlabel: umbrella",
+				"charts/redis/charts/metrics/templates/x.yaml": `{"global":{"env":"staging","zone":"a"},"interval":"10s"}`,
+			},
+		},
+		{
+			name: "null deletes subchart defaults",
+			opts: Options{Set: []string{"redis.replicas=null"}},
+			expected: map[string]string{
+				"cm.yaml": `redis: {"global":{"env":"prod","zone":"a"},"metrics":{"global":{"env":"prod","zone":"a"},"interval":"30s"},"port":6380}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			tokens, err := h.RenderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			rendered := RenderAllFilesToString(tokens)
+			for file, want := range tt.expected {
+				if got := rendered[file]; got != want {
+					t.Errorf("%s: expected:\n%s\ngot:\n%s", file, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderDependencies(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml": `apiVersion: v2
+name: umbrella
+version: 0.1.0
+dependencies:
+  - name: redis
+    condition: redis.enabled,global.redis.enabled
+  - name: redis
+    alias: cache
+    condition: cache.enabled
+  - name: postgresql
+    tags: [db]
+  - name: exporter
+    import-values:
+      - data
+      - child: settings
+        parent: monitoring.exporter
+`,
+		"values.yaml":                          "redis:\n  enabled: true\ncache:\n  enabled: false\n  port: 7000\ntags:\n  db: false\n",
+		"templates/cm.yaml":                    "{{ toJson .Values }}",
+		"charts/redis/Chart.yaml":              "apiVersion: v2\nname: redis\nversion: 7.0.0\n",
+		"charts/redis/values.yaml":             "port: 6379\n",
+		"charts/redis/templates/svc.yaml":      "name: {{ .Chart.Name }}\nport: {{ .Values.port }}",
+		"charts/postgresql/Chart.yaml":         "apiVersion: v2\nname: postgresql\nversion: 15.0.0\n",
+		"charts/postgresql/values.yaml":        "port: 5432\n",
+		"charts/postgresql/templates/svc.yaml": "port: {{ .Values.port }}",
+		"charts/exporter/Chart.yaml":           "apiVersion: v2\nname: exporter\nversion: 1.0.0\n",
+		"charts/exporter/values.yaml":          "exports:\n  data:\n    scrape: true\nsettings:\n  interval: 30s\n",
+		"charts/exporter/templates/x.yaml":     "interval: {{ .Values.settings.interval }}",
+	})
+
+	tests := []struct {
+		name      string
+		opts      Options
+		files     []string
+		enabled   []string
+		expected  string
+		manifests map[string]string // expected content of other files
+	}{
+		{
+			name:      "conditions, tags, aliases and imports",
+			files:     []string{"charts/exporter/templates/x.yaml", "charts/redis/templates/svc.yaml", "cm.yaml"},
+			enabled:   []string{"charts/redis", "charts/exporter"},
+			expected:  `{"cache":{"enabled":false,"port":7000},"exporter":{"exports":{"data":{"scrape":true}},"settings":{"interval":"30s"}},"monitoring":{"exporter":{"interval":"30s"}},"redis":{"enabled":true,"port":6379},"scrape":true,"tags":{"db":false}}`,
+			manifests: map[string]string{"charts/redis/templates/svc.yaml": "name: redis\nport: 6379"},
+		},
+		{
+			name:      "alias renders under its own key",
+			opts:      Options{Set: []string{"cache.enabled=true,redis.enabled=false,tags.db=true"}},
+			files:     []string{"charts/cache/templates/svc.yaml", "charts/exporter/templates/x.yaml", "charts/postgresql/templates/svc.yaml", "cm.yaml"},
+			enabled:   []string{"charts/cache", "charts/postgresql", "charts/exporter"},
+			expected:  `{"cache":{"enabled":true,"port":7000},"exporter":{"exports":{"data":{"scrape":true}},"settings":{"interval":"30s"}},"monitoring":{"exporter":{"interval":"30s"}},"postgresql":{"port":5432},"redis":{"enabled":false},"scrape":true,"tags":{"db":true}}`,
+			manifests: map[string]string{"charts/cache/templates/svc.yaml": "name: cache\nport: 7000"},
+		},
+		{
+			name:    "the first condition path holding a boolean decides",
+			opts:    Options{Set: []string{"redis.enabled=null,global.redis.enabled=false"}},
+			files:   []string{"charts/exporter/templates/x.yaml", "cm.yaml"},
+			enabled: []string{"charts/exporter"},
+		},
+		{
+			name:     "parent values take precedence over imports",
+			opts:     Options{Set: []string{"scrape=false,monitoring.exporter.interval=1m"}},
+			files:    []string{"charts/exporter/templates/x.yaml", "charts/redis/templates/svc.yaml", "cm.yaml"},
+			enabled:  []string{"charts/redis", "charts/exporter"},
+			expected: `{"cache":{"enabled":false,"port":7000},"exporter":{"exports":{"data":{"scrape":true}},"settings":{"interval":"30s"}},"monitoring":{"exporter":{"interval":"1m"}},"redis":{"enabled":true,"port":6379},"scrape":false,"tags":{"db":false}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHelmish(chartPath)
+			if err != nil {
+				t.Fatalf("NewHelmish: %v", err)
+			}
+			tokens, err := h.RenderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			var files []string
+			for file := range tokens {
+				files = append(files, file)
+			}
+			sort.Strings(files)
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("expected files %v, got %v", tt.files, files)
+			}
+			rendered := RenderAllFilesToString(tokens)
+			if tt.expected != "" {
+				if got := rendered["cm.yaml"]; got != tt.expected {
+					t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+				}
+			}
+			for file, want := range tt.manifests {
+				if got := rendered[file]; got != want {
+					t.Errorf("%s: expected:\n%s\ngot:\n%s", file, want, got)
+				}
+			}
+
+			deps, err := h.Dependencies(tt.opts)
+			if err != nil {
+				t.Fatalf("Dependencies: %v", err)
+			}
+			var enabled []string
+			for _, d := range deps {
+				if d.Enabled {
+					enabled = append(enabled, d.Path)
+				}
+			}
+			if !reflect.DeepEqual(enabled, tt.enabled) {
+				t.Errorf("expected enabled dependencies %v, got %v", tt.enabled, enabled)
+			}
+		})
+	}
+}
+
+func TestRenderDependencies_Missing(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":        "apiVersion: v2\nname: umbrella\nversion: 0.1.0\ndependencies:\n  - name: redis\n    repository: https://charts.example.com\n",
+		"values.yaml":       "{}\n",
+		"templates/cm.yaml": "x: 1",
+	})
+	h, err := NewHelmish(chartPath)
+	if err != nil {
+		t.Fatalf("NewHelmish: %v", err)
+	}
+	_, err = h.Render(Profile{Name: "default"})
+	if err == nil || !strings.Contains(err.Error(), `dependency "redis" found in Chart.yaml, but missing in charts/ directory`) {
+		t.Fatalf("expected a missing dependency error, got %v", err)
+	}
+}
+
+// buildArchive packages files into a gzipped chart tarball under the
+// top-level directory root, like helm package does
+func buildArchive(t *testing.T, root string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedNames(files) {
+		content := files[name]
+		hdr := &tar.Header{Name: root + "/" + name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRender_TemplatesDoNotModifyValues(t *testing.T) {
+	chartPath := t.TempDir()
+	writeChart(t, chartPath, map[string]string{
+		"Chart.yaml":                      "apiVersion: v2\nname: umbrella\nversion: 0.1.0\n",
+		"values.yaml":                     "config:\n  a: 1\n",
+		"templates/cm.yaml":               "a: {{ .Values.config.a }}{{ $_ := set .Values.config \"a\" 99 }}",
+		"charts/redis/Chart.yaml":         "apiVersion: v2\nname: redis\nversion: 7.0.0\n",
+		"charts/redis/values.yaml":        "auth:\n  user: admin\n",
+		"charts/redis/templates/svc.yaml": "user: {{ .Values.auth.user }}{{ $_ := set .Values.auth \"user\" \"root\" }}",
+	})
+
+	h, err := NewHelmish(chartPath)
+	if err != nil {
+		t.Fatalf("NewHelmish: %v", err)
+	}
+	opts := Options{Set: []string{"extra.b=2"}}
+	var renders []map[string]string
+	for i := 0; i < 2; i++ {
+		tokens, err := h.RenderWithOptions(opts)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		renders = append(renders, RenderAllFilesToString(tokens))
+	}
+	expected := map[string]string{
+		"cm.yaml":                         "a: 1",
+		"charts/redis/templates/svc.yaml": "user: admin",
+	}
+	for i, rendered := range renders {
+		if !reflect.DeepEqual(rendered, expected) {
+			t.Errorf("render %d: expected %q, got %q", i+1, expected, rendered)
+		}
+	}
+}
+
+func TestNewHelmishFS(t *testing.T) {
+	redis := buildArchive(t, "redis", map[string]string{
+		"Chart.yaml":         "apiVersion: v2\nname: redis\nversion: 7.0.0\n",
+		"values.yaml":        "port: 6379\n",
+		"templates/svc.yaml": "port: {{ .Values.port }}",
+	})
+	fsys := fstest.MapFS{
+		"Chart.yaml":                       {Data: []byte("apiVersion: v2\nname: mem-chart\nversion: 0.1.0\n")},
+		"values.yaml":                      {Data: []byte("replicas: 1\n")},
+		"profiles/prod.yaml":               {Data: []byte("values:\n  replicas: 3\n  redis:\n    port: 6380\n")},
+		"config/app.conf":                  {Data: []byte("port=80\n")},
+		"templates/cm.yaml":                {Data: []byte("replicas: {{ .Values.replicas }}\nconf: {{ .Files.Get \"config/app.conf\" | trim }}")},
+		"charts/redis-7.0.0.tgz":           {Data: redis},
+		"charts/unpacked/Chart.yaml":       {Data: []byte("apiVersion: v2\nname: unpacked\nversion: 1.0.0\n")},
+		"charts/unpacked/templates/x.yaml": {Data: []byte("chart: {{ .Chart.Name }}")},
+	}
+
+	h, err := NewHelmishFS(fsys)
+	if err != nil {
+		t.Fatalf("NewHelmishFS: %v", err)
+	}
+	tokens, err := h.Render(Profile{Name: "prod"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	expected := map[string]string{
+		"cm.yaml":                          "replicas: 3\nconf: port=80",
+		"charts/redis/templates/svc.yaml":  "port: 6380",
+		"charts/unpacked/templates/x.yaml": "chart: unpacked",
+	}
+	rendered := RenderAllFilesToString(tokens)
+	if !reflect.DeepEqual(rendered, expected) {
+		t.Errorf("expected %q, got %q", expected, rendered)
+	}
+}
+
+func TestNewHelmish_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archive := buildArchive(t, "web", map[string]string{
+		"Chart.yaml":            "apiVersion: v2\nname: web\nversion: 1.2.3\n",
+		"values.yaml":           "image: nginx\n",
+		"profiles/staging.yaml": "values:\n  image: nginx:rc\n",
+		"templates/deploy.yaml": "image: {{ .Values.image }}\nchart: {{ .Chart.Name }}-{{ .Chart.Version }}",
+	})
+	chartPath := filepath.Join(dir, "web-1.2.3.tgz")
+	if err := os.WriteFile(chartPath, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeChart(t, dir, map[string]string{"corrupt.tgz": "not gzip"})
+
+	h, err := NewHelmish(chartPath)
+	if err != nil {
+		t.Fatalf("NewHelmish: %v", err)
+	}
+	tokens, err := h.Render(Profile{Name: "staging"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got, want := RenderAllFilesToString(tokens)["deploy.yaml"], "image: nginx:rc\nchart: web-1.2.3"; got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if _, err := NewHelmish(filepath.Join(dir, "corrupt.tgz")); err == nil || !strings.Contains(err.Error(), "corrupt.tgz") {
+		t.Errorf("expected an error naming the corrupt archive, got %v", err)
+	}
+}
+
+func TestRenderHelmIgnore(t *testing.T) {
+	fsys := fstest.MapFS{
+		".helmignore":                 {Data: []byte("# backups\n*~\n*.orig\n!keep.orig\n/docs/\n**/generated/**\ncharts/old/\n")},
+		"Chart.yaml":                  {Data: []byte("apiVersion: v2\nname: ignored\nversion: 0.1.0\n")},
+		"templates/cm.yaml":           {Data: []byte("a: {{ .Files.Get \"keep.orig\" | trim }}\nb: {{ .Files.Get \"drop.orig\" | trim }}\nc: {{ .Files.Get \"docs/x.md\" | trim }}")},
+		"templates/cm.yaml~":          {Data: []byte("broken: {{")},
+		"templates/.cm.yaml.swp":      {Data: []byte("broken: {{")},
+		"templates/generated/x.yaml":  {Data: []byte("broken: {{")},
+		"keep.orig":                   {Data: []byte("kept\n")},
+		"drop.orig":                   {Data: []byte("dropped\n")},
+		"docs/x.md":                   {Data: []byte("docs\n")},
+		"charts/old/Chart.yaml":       {Data: []byte("apiVersion: v2\nname: old\nversion: 1.0.0\n")},
+		"charts/old/templates/x.yaml": {Data: []byte("old: true")},
+		"charts/sub/Chart.yaml":       {Data: []byte("apiVersion: v2\nname: sub\nversion: 1.0.0\n")},
+		"charts/sub/.helmignore":      {Data: []byte("*.bak\n")},
+		"charts/sub/templates/x.yaml": {Data: []byte("sub: true")},
+		"charts/sub/templates/x.bak":  {Data: []byte("broken: {{")},
+	}
+
+	h, err := NewHelmishFS(fsys)
+	if err != nil {
+		t.Fatalf("NewHelmishFS: %v", err)
+	}
+	tokens, err := h.Render(Profile{})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	expected := map[string]string{
+		"cm.yaml":                     "a: kept\nb: \nc:",
+		"charts/sub/templates/x.yaml": "sub: true",
+	}
+	rendered := RenderAllFilesToString(tokens)
+	if !reflect.DeepEqual(rendered, expected) {
+		t.Errorf("expected %q, got %q", expected, rendered)
+	}
+
+	ignored := []string{
+		"charts/old",
+		"charts/sub/templates/x.bak",
+		"docs",
+		"drop.orig",
+		"templates/.cm.yaml.swp",
+		"templates/cm.yaml~",
+		"templates/generated/x.yaml",
+	}
+	if !reflect.DeepEqual(h.Ignored(), ignored) {
+		t.Errorf("expected ignored paths %q, got %q", ignored, h.Ignored())
+	}
+}
+
+func TestRenderResult_TemplateKinds(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Chart.yaml":                     {Data: []byte("apiVersion: v2\nname: kinds\nversion: 0.1.0\n")},
+		"values.yaml":                    {Data: []byte("name: web\n")},
+		"templates/_helpers.tpl":         {Data: []byte(`{{- define "kinds.name" -}}{{ .Values.name }}{{- end -}}`)},
+		"templates/_labels.yaml":         {Data: []byte("{{- define \"kinds.labels\" -}}\napp: {{ include \"kinds.name\" . }}\n{{- end -}}\nignored: output")},
+		"templates/cm.yaml":              {Data: []byte("metadata:\n  labels:\n    {{- include \"kinds.labels\" . | nindent 4 }}")},
+		"templates/dashboard.json":       {Data: []byte(`{"title": "{{ include "kinds.name" . }}"}`)},
+		"templates/README.md":            {Data: []byte("not a template {{")},
+		"templates/NOTES.txt":            {Data: []byte("Installed {{ include \"kinds.name\" . }} as {{ .Release.Name }} from {{ .Template.Name }}.\n")},
+		"charts/sub/Chart.yaml":          {Data: []byte("apiVersion: v2\nname: sub\nversion: 1.0.0\n")},
+		"charts/sub/templates/NOTES.txt": {Data: []byte("subchart notes")},
+	}
+
+	h, err := NewHelmishFS(fsys)
+	if err != nil {
+		t.Fatalf("NewHelmishFS: %v", err)
+	}
+	result, err := h.RenderResult(Options{Profile: Profile{Release: Release{Name: "prod"}}})
+	if err != nil {
+		t.Fatalf("RenderResult: %v", err)
+	}
+	expected := map[string]string{
+		"cm.yaml":        "metadata:\n  labels:\n    app: web",
+		"dashboard.json": `{"title": "web"}`,
+	}
+	rendered := RenderAllFilesToString(result.Manifests)
+	if !reflect.DeepEqual(rendered, expected) {
+		t.Errorf("expected %q, got %q", expected, rendered)
+	}
+	notes := "Installed web as prod from kinds/templates/NOTES.txt.\n"
+	if result.Notes != notes {
+		t.Errorf("expected notes %q, got %q", notes, result.Notes)
+	}
+}
+
+func TestRenderResult_LibraryAndCRDs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Chart.yaml":                     {Data: []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n")},
+		"crds/widget.yaml":               {Data: []byte("kind: CustomResourceDefinition\nname: {{ not templated }}\n---\nkind: CustomResourceDefinition\nname: second\n")},
+		"templates/cm.yaml":              {Data: []byte(`{{ include "common.labels" . }}`)},
+		"charts/common/Chart.yaml":       {Data: []byte("apiVersion: v2\nname: common\ntype: library\nversion: 1.0.0\n")},
+		"charts/common/templates/_x.tpl": {Data: []byte(`{{- define "common.labels" -}}chart: {{ .Chart.Name }}{{- end -}}`)},
+		"charts/common/templates/x.yaml": {Data: []byte("library: output")},
+		"charts/common/crds/lib.yaml":    {Data: []byte("kind: CustomResourceDefinition\nname: library\n")},
+		"charts/db/Chart.yaml":           {Data: []byte("apiVersion: v2\nname: db\nversion: 1.0.0\n")},
+		"charts/db/crds/db.yaml":         {Data: []byte("kind: CustomResourceDefinition\nname: db\n")},
+		"charts/db/templates/db.yaml":    {Data: []byte("kind: Db")},
+	}
+
+	h, err := NewHelmishFS(fsys)
+	if err != nil {
+		t.Fatalf("NewHelmishFS: %v", err)
+	}
+	result, err := h.RenderResult(Options{})
+	if err != nil {
+		t.Fatalf("RenderResult: %v", err)
+	}
+	expected := map[string]string{"cm.yaml": "chart: app", "charts/db/templates/db.yaml": "kind: Db"}
+	if rendered := RenderAllFilesToString(result.Manifests); !reflect.DeepEqual(rendered, expected) {
+		t.Errorf("expected %q, got %q", expected, rendered)
+	}
+	expectedCRDs := map[string][]string{
+		"crds/widget.yaml":       {"kind: CustomResourceDefinition\nname: {{ not templated }}", "kind: CustomResourceDefinition\nname: second"},
+		"charts/db/crds/db.yaml": {"kind: CustomResourceDefinition\nname: db"},
+	}
+	crds := make(map[string][]string)
+	for name, docs := range result.CRDs {
+		for _, doc := range docs {
+			crds[name] = append(crds[name], RenderTokensToString([][]Token{doc}))
+		}
+	}
+	if !reflect.DeepEqual(crds, expectedCRDs) {
+		t.Errorf("expected CRDs %q, got %q", expectedCRDs, crds)
+	}
+
+	result, err = h.RenderResult(Options{SkipCRDs: true})
+	if err != nil {
+		t.Fatalf("RenderResult: %v", err)
+	}
+	if len(result.CRDs) != 0 {
+		t.Errorf("expected no CRDs, got %v", result.CRDs)
+	}
+
+	library, err := NewHelmishFS(fstest.MapFS{
+		"Chart.yaml":       {Data: []byte("apiVersion: v2\nname: lib\ntype: library\nversion: 1.0.0\n")},
+		"templates/x.yaml": {Data: []byte("library: output")},
+	})
+	if err != nil {
+		t.Fatalf("NewHelmishFS: %v", err)
+	}
+	tokens, err := library.Render(Profile{})
+	if err == nil || !strings.Contains(err.Error(), "library charts are not installable") {
+		t.Errorf("expected an error for a library chart, got %v and manifests %q", err, RenderAllFilesToString(tokens))
+	}
+}
@@ -0,0 +1,450 @@
+// Package strvals parses the key=value override syntax of helm's --set,
+// --set-string, --set-json and --set-file flags into values maps.
+//
+// A set expression is a comma separated list of assignments. Keys are dotted
+// paths into nested maps, and may index lists: a.b[0].c=x. Special
+// characters in keys and values are escaped with a backslash, e.g.
+// annotations.kubernetes\.io/name=x or list=a\,b. A value written as {a,b}
+// is a list.
+package strvals
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxIndex is the largest list index an expression may set
+const MaxIndex = 65536
+
+// MaxNestedNameLevel is the deepest key nesting an expression may use
+const MaxNestedNameLevel = 30
+
+// errNotList reports that a value does not start with {
+var errNotList = errors.New("not a list")
+
+// RunesValueReader turns the raw text of a value into the value to set
+type RunesValueReader func([]rune) (interface{}, error)
+
+// Parse parses a set expression into a new map. Values are typed: true and
+// false become booleans, null becomes nil and integers become int64.
+func Parse(s string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	return vals, ParseInto(s, vals)
+}
+
+// ParseString parses a set expression into a new map, keeping every value
+// as a string
+func ParseString(s string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	return vals, ParseIntoString(s, vals)
+}
+
+// ParseInto parses a set expression into dest, like Parse
+func ParseInto(s string, dest map[string]interface{}) error {
+	return newParser(s, dest, func(rs []rune) (interface{}, error) {
+		return typedVal(string(rs), false), nil
+	}, false).parse()
+}
+
+// ParseIntoString parses a set expression into dest, like ParseString
+func ParseIntoString(s string, dest map[string]interface{}) error {
+	return newParser(s, dest, func(rs []rune) (interface{}, error) {
+		return typedVal(string(rs), true), nil
+	}, false).parse()
+}
+
+// ParseJSON parses a set expression whose values are JSON documents, like
+// helm's --set-json, into dest
+func ParseJSON(s string, dest map[string]interface{}) error {
+	return newParser(s, dest, nil, true).parse()
+}
+
+// ParseFile parses a set expression into a new map, turning each value into
+// the value to set with reader. With a reader that loads the named file this
+// implements helm's --set-file.
+func ParseFile(s string, reader RunesValueReader) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	return vals, ParseIntoFile(s, vals, reader)
+}
+
+// ParseIntoFile parses a set expression into dest, like ParseFile
+func ParseIntoFile(s string, dest map[string]interface{}, reader RunesValueReader) error {
+	return newParser(s, dest, reader, false).parse()
+}
+
+// typedVal converts the text of a value. Unless asString is set, true,
+// false and null are converted, as are integers without a leading zero.
+func typedVal(val string, asString bool) interface{} {
+	if asString {
+		return val
+	}
+	switch {
+	case strings.EqualFold(val, "true"):
+		return true
+	case strings.EqualFold(val, "false"):
+		return false
+	case strings.EqualFold(val, "null"):
+		return nil
+	case val == "0":
+		return int64(0)
+	}
+	// Numbers with a leading zero, like zip codes, stay strings
+	if len(val) != 0 && val[0] != '0' {
+		if iv, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return iv
+		}
+	}
+	return val
+}
+
+// parser reads a set expression rune by rune
+type parser struct {
+	sc        *bytes.Buffer
+	data      map[string]interface{}
+	reader    RunesValueReader
+	isJSONVal bool
+}
+
+func newParser(s string, dest map[string]interface{}, reader RunesValueReader, isJSONVal bool) *parser {
+	return &parser{sc: bytes.NewBufferString(s), data: dest, reader: reader, isJSONVal: isJSONVal}
+}
+
+// parse reads assignments until the input is exhausted
+func (t *parser) parse() error {
+	for {
+		err := t.key(t.data, 0)
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+}
+
+// key reads one key path and its value into data. It returns nil when more
+// assignments follow and io.EOF at the end of the input.
+func (t *parser) key(data map[string]interface{}, nestedNameLevel int) error {
+	k, last, err := runesUntil(t.sc, "=[,.")
+	if err != nil {
+		if len(k) == 0 {
+			return err
+		}
+		return fmt.Errorf("key %q has no value", string(k))
+	}
+	name := string(k)
+	switch last {
+	case '[':
+		i, err := t.keyIndex()
+		if err != nil {
+			return fmt.Errorf("error parsing index: %v", err)
+		}
+		list := []interface{}{}
+		if existing, ok := data[name]; ok && existing != nil {
+			if list, ok = existing.([]interface{}); !ok {
+				return fmt.Errorf("key %q is not a list", name)
+			}
+		}
+		list, err = t.listItem(list, i, nestedNameLevel)
+		set(data, name, list)
+		return err
+	case '=':
+		if t.isJSONVal {
+			val, err := t.jsonVal()
+			if err != nil && err != io.EOF {
+				return err
+			}
+			set(data, name, val)
+			return err
+		}
+		vl, err := t.valList()
+		switch err {
+		case nil:
+			set(data, name, vl)
+			return nil
+		case io.EOF:
+			set(data, name, "")
+			return err
+		case errNotList:
+			rs, err := t.val()
+			if err != nil && err != io.EOF {
+				return err
+			}
+			v, rerr := t.reader(rs)
+			if rerr != nil {
+				return rerr
+			}
+			set(data, name, v)
+			return err
+		default:
+			return err
+		}
+	case ',':
+		set(data, name, "")
+		return fmt.Errorf("key %q has no value (cannot end with ,)", name)
+	default: // '.'
+		nestedNameLevel++
+		if nestedNameLevel > MaxNestedNameLevel {
+			return fmt.Errorf("value name nested level is greater than maximum supported nested level of %d", MaxNestedNameLevel)
+		}
+		inner := map[string]interface{}{}
+		if existing, ok := data[name]; ok && existing != nil {
+			if inner, ok = existing.(map[string]interface{}); !ok {
+				return fmt.Errorf("key %q is not a map", name)
+			}
+		}
+		err := t.key(inner, nestedNameLevel)
+		if (err == nil || err == io.EOF) && len(inner) == 0 {
+			return fmt.Errorf("key map %q has no value", name)
+		}
+		if len(inner) != 0 {
+			set(data, name, inner)
+		}
+		return err
+	}
+}
+
+// keyIndex reads a list index up to the closing ]
+func (t *parser) keyIndex() (int, error) {
+	v, _, err := runesUntil(t.sc, "]")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(v))
+}
+
+// listItem reads what follows the index i of list: a value, a nested list
+// index or a nested key. It returns the updated list.
+func (t *parser) listItem(list []interface{}, i, nestedNameLevel int) ([]interface{}, error) {
+	if i < 0 {
+		return list, fmt.Errorf("negative %d index not allowed", i)
+	}
+	k, last, err := runesUntil(t.sc, "[.=")
+	switch {
+	case len(k) > 0:
+		return list, fmt.Errorf("unexpected data at end of array index: %q", string(k))
+	case err != nil:
+		return list, err
+	}
+	switch last {
+	case '=':
+		if t.isJSONVal {
+			val, err := t.jsonVal()
+			if err != nil && err != io.EOF {
+				return list, err
+			}
+			list, serr := setIndex(list, i, val)
+			if serr != nil {
+				return list, serr
+			}
+			return list, err
+		}
+		vl, err := t.valList()
+		switch err {
+		case nil:
+			return setIndex(list, i, vl)
+		case io.EOF:
+			return setIndex(list, i, "")
+		case errNotList:
+			rs, err := t.val()
+			if err != nil && err != io.EOF {
+				return list, err
+			}
+			v, rerr := t.reader(rs)
+			if rerr != nil {
+				return list, rerr
+			}
+			list, serr := setIndex(list, i, v)
+			if serr != nil {
+				return list, serr
+			}
+			return list, err
+		default:
+			return list, err
+		}
+	case '[':
+		nextI, err := t.keyIndex()
+		if err != nil {
+			return list, fmt.Errorf("error parsing index: %v", err)
+		}
+		var inner []interface{}
+		if i < len(list) && list[i] != nil {
+			var ok bool
+			if inner, ok = list[i].([]interface{}); !ok {
+				return list, fmt.Errorf("index %d is not a list", i)
+			}
+		}
+		inner, err = t.listItem(inner, nextI, nestedNameLevel)
+		if err != nil && err != io.EOF {
+			return list, err
+		}
+		list, serr := setIndex(list, i, inner)
+		if serr != nil {
+			return list, serr
+		}
+		return list, err
+	default: // '.'
+		inner := map[string]interface{}{}
+		if i < len(list) {
+			// An index that was not set yet, or set to something else,
+			// starts out as an empty map
+			if m, ok := list[i].(map[string]interface{}); ok {
+				inner = m
+			}
+		}
+		err := t.key(inner, nestedNameLevel)
+		if err != nil && err != io.EOF {
+			return list, err
+		}
+		list, serr := setIndex(list, i, inner)
+		if serr != nil {
+			return list, serr
+		}
+		return list, err
+	}
+}
+
+// val reads a plain value up to the next unescaped comma
+func (t *parser) val() ([]rune, error) {
+	v, _, err := runesUntil(t.sc, ",")
+	return v, err
+}
+
+// valList reads a {a,b,c} list value. It returns errNotList, without
+// consuming anything, when the value is not a list.
+func (t *parser) valList() ([]interface{}, error) {
+	r, _, err := t.sc.ReadRune()
+	if err != nil {
+		return []interface{}{}, err
+	}
+	if r != '{' {
+		t.sc.UnreadRune()
+		return []interface{}{}, errNotList
+	}
+	list := []interface{}{}
+	for {
+		rs, last, err := runesUntil(t.sc, ",}")
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("list must terminate with '}'")
+			}
+			return list, err
+		}
+		v, err := t.reader(rs)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, v)
+		if last == '}' {
+			// Consume the comma separating the list from the next assignment
+			if r, _, err := t.sc.ReadRune(); err == nil && r != ',' {
+				t.sc.UnreadRune()
+			}
+			return list, nil
+		}
+	}
+}
+
+// jsonVal decodes a single JSON document and consumes the comma following
+// it. An empty value is null.
+func (t *parser) jsonVal() (interface{}, error) {
+	empty, err := t.emptyVal()
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, nil
+	}
+	var val interface{}
+	dec := json.NewDecoder(strings.NewReader(t.sc.String()))
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, t.sc, dec.InputOffset()); err != nil {
+		return nil, err
+	}
+	if _, err := t.emptyVal(); err != nil {
+		return nil, err
+	}
+	if t.sc.Len() == 0 {
+		return val, io.EOF
+	}
+	return val, nil
+}
+
+// emptyVal skips blanks and reports whether the value ends there, at a
+// comma, which is consumed, or at the end of the input
+func (t *parser) emptyVal() (bool, error) {
+	for {
+		r, _, err := t.sc.ReadRune()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ',':
+			return true, nil
+		}
+		t.sc.UnreadRune()
+		return false, nil
+	}
+}
+
+// runesUntil reads runes up to the first unescaped rune of stop. It
+// returns the runes read, with escapes removed, and the stop rune found.
+func runesUntil(in io.RuneReader, stop string) ([]rune, rune, error) {
+	var v []rune
+	for {
+		r, _, err := in.ReadRune()
+		switch {
+		case err != nil:
+			return v, r, err
+		case strings.ContainsRune(stop, r):
+			return v, r, nil
+		case r == '\\':
+			next, _, err := in.ReadRune()
+			if err != nil {
+				// A trailing backslash is kept as is
+				return append(v, r), next, err
+			}
+			v = append(v, next)
+		default:
+			v = append(v, r)
+		}
+	}
+}
+
+// set stores a value under a non-empty key
+func set(data map[string]interface{}, key string, val interface{}) {
+	if len(key) == 0 {
+		return
+	}
+	data[key] = val
+}
+
+// setIndex stores a value at index, growing the list as needed
+func setIndex(list []interface{}, index int, val interface{}) ([]interface{}, error) {
+	if index < 0 {
+		return list, fmt.Errorf("negative %d index not allowed", index)
+	}
+	if index > MaxIndex {
+		return list, fmt.Errorf("index of %d is greater than maximum supported index of %d", index, MaxIndex)
+	}
+	if len(list) <= index {
+		grown := make([]interface{}, index+1)
+		copy(grown, list)
+		list = grown
+	}
+	list[index] = val
+	return list, nil
+}
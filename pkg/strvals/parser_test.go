@@ -0,0 +1,167 @@
+package strvals
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type m = map[string]interface{}
+type l = []interface{}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]interface{}
+		err      string
+	}{
+		{name: "empty", input: "", expected: m{}},
+		{name: "single", input: "name=value", expected: m{"name": "value"}},
+		{name: "pairs", input: "a=1,b=two", expected: m{"a": int64(1), "b": "two"}},
+		{name: "typed values", input: "t=true,f=FALSE,n=null,z=0,i=-42", expected: m{"t": true, "f": false, "n": nil, "z": int64(0), "i": int64(-42)}},
+		{name: "leading zero stays string", input: "zip=01234", expected: m{"zip": "01234"}},
+		{name: "float stays string", input: "ratio=1.5", expected: m{"ratio": "1.5"}},
+		{name: "empty value", input: "a=", expected: m{"a": ""}},
+		{name: "empty value before pair", input: "a=,b=1", expected: m{"a": "", "b": int64(1)}},
+		{name: "value with equals", input: "a=b=c", expected: m{"a": "b=c"}},
+		{name: "dotted path", input: "image.repo=nginx,image.tag=1.25", expected: m{"image": m{"repo": "nginx", "tag": "1.25"}}},
+		{name: "deep path", input: "a.b.c.d=x", expected: m{"a": m{"b": m{"c": m{"d": "x"}}}}},
+		{name: "escaped dot in key", input: `annotations.kubernetes\.io/name=web`, expected: m{"annotations": m{"kubernetes.io/name": "web"}}},
+		{name: "escaped comma in value", input: `list=a\,b,c=d`, expected: m{"list": "a,b", "c": "d"}},
+		{name: "escaped backslash", input: `path=c:\\dir`, expected: m{"path": `c:\dir`}},
+		{name: "list value", input: "args={a,b,3}", expected: m{"args": l{"a", "b", int64(3)}}},
+		{name: "list value before pair", input: "args={a,b},x=y", expected: m{"args": l{"a", "b"}, "x": "y"}},
+		{name: "list index", input: "a[0]=x,a[1]=y", expected: m{"a": l{"x", "y"}}},
+		{name: "list index grows", input: "a[2]=x", expected: m{"a": l{nil, nil, "x"}}},
+		{name: "nested list index", input: "a[0][1]=x", expected: m{"a": l{l{nil, "x"}}}},
+		{name: "map in list", input: "a.b[0].c=x,a.b[0].d=y,a.b[1].c=z", expected: m{"a": m{"b": l{m{"c": "x", "d": "y"}, m{"c": "z"}}}}},
+		{name: "list value at index", input: "a[0]={x,y}", expected: m{"a": l{l{"x", "y"}}}},
+		{name: "later pair wins", input: "a=1,a=2", expected: m{"a": int64(2)}},
+		{name: "key without value", input: "name", err: `key "name" has no value`},
+		{name: "key ending with comma", input: "name,a=b", err: `key "name" has no value (cannot end with ,)`},
+		{name: "key map without value", input: "a.", err: `key map "a" has no value`},
+		{name: "unterminated list", input: "a={x,y", err: "list must terminate with '}'"},
+		{name: "bad index", input: "a[x]=1", err: "error parsing index"},
+		{name: "negative index", input: "a[-1]=1", err: "negative -1 index not allowed"},
+		{name: "index too large", input: "a[65537]=1", err: "greater than maximum supported index"},
+		{name: "data after index", input: "a[0]x=1", err: "unexpected data at end of array index"},
+		{name: "map over list", input: "a[0]=1,a.b=2", err: `key "a" is not a map`},
+		{name: "list over map", input: "a.b=1,a[0]=2", err: `key "a" is not a list`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseInto(t *testing.T) {
+	dest := m{"image": m{"repo": "nginx", "tag": "1.0"}, "ports": l{int64(80)}}
+	if err := ParseInto("image.tag=2.0,ports[1]=443", dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := m{"image": m{"repo": "nginx", "tag": "2.0"}, "ports": l{int64(80), int64(443)}}
+	if !reflect.DeepEqual(dest, expected) {
+		t.Errorf("expected %#v, got %#v", expected, dest)
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]interface{}
+	}{
+		{name: "numbers", input: "a=1,b=0", expected: m{"a": "1", "b": "0"}},
+		{name: "booleans and null", input: "a=true,b=null", expected: m{"a": "true", "b": "null"}},
+		{name: "list", input: "a={1,true}", expected: m{"a": l{"1", "true"}}},
+		{name: "index", input: "a[0].b=1", expected: m{"a": l{m{"b": "1"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseString(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]interface{}
+		err      string
+	}{
+		{name: "object", input: `a={"b":1,"c":[true,"x"]}`, expected: m{"a": m{"b": float64(1), "c": l{true, "x"}}}},
+		{name: "pairs", input: `a=[1,2],b="s"`, expected: m{"a": l{float64(1), float64(2)}, "b": "s"}},
+		{name: "blanks before comma", input: `a=1 ,b=2`, expected: m{"a": float64(1), "b": float64(2)}},
+		{name: "dotted path", input: `x.y={"z":null}`, expected: m{"x": m{"y": m{"z": nil}}}},
+		{name: "list index", input: `a[1]={"b":2}`, expected: m{"a": l{nil, m{"b": float64(2)}}}},
+		{name: "empty value is null", input: `a=,b=1`, expected: m{"a": nil, "b": float64(1)}},
+		{name: "invalid json", input: `a={b}`, err: "invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m{}
+			err := ParseJSON(tt.input, got)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	files := map[string]string{"cert.pem": "-----BEGIN-----\n", "conf.ini": "a=b\n"}
+	reader := func(rs []rune) (interface{}, error) {
+		content, ok := files[string(rs)]
+		if !ok {
+			return nil, fmt.Errorf("open %s: no such file", string(rs))
+		}
+		return content, nil
+	}
+
+	got, err := ParseFile("tls.cert=cert.pem,config=conf.ini", reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := m{"tls": m{"cert": "-----BEGIN-----\n"}, "config": "a=b\n"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+
+	if _, err := ParseFile("a=missing", reader); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("expected reader error, got %v", err)
+	}
+}